@@ -1,9 +1,5 @@
 package marid
 
-import (
-	"flag"
-)
-
 type BlockSet struct {
 	b map[string]Block
 }
@@ -31,7 +27,7 @@ func (b *BlockSet) GetBlocks() map[string]Block {
 
 type Block interface {
 	Tag() string
-	Flags() *flag.FlagSet
+	Params() ParamSet
 	Loaders() []Loader
 	Funcs() map[string]interface{}
 	Templates() []string
@@ -40,35 +36,90 @@ type Block interface {
 }
 
 type block struct {
-	tag       string
-	flags     *flag.FlagSet
-	loaders   []Loader
-	funcs     map[string]interface{}
-	templates []string
-	directory string
-	pckge     string
+	tag         string
+	params      ParamSet
+	loaders     []Loader
+	funcs       map[string]interface{}
+	templates   []string
+	directory   string
+	pckge       string
+	description string
+	outputs     map[string]string
+	processors  map[string][]PostProcessor
+	imports     []string
+}
+
+type BlockOption func(*block)
+
+func Description(d string) BlockOption {
+	return func(b *block) {
+		b.description = d
+	}
+}
+
+// OutputNames maps template names to output file name patterns. Patterns
+// are templates executed with the block data, and may name files in
+// subdirectories of the block directory.
+func OutputNames(patterns map[string]string) BlockOption {
+	return func(b *block) {
+		b.outputs = patterns
+	}
+}
+
+// PostProcess sets the post processors run, in order, on the output of a
+// template in place of the defaults chosen by output file extension.
+func PostProcess(t string, pp ...PostProcessor) BlockOption {
+	return func(b *block) {
+		if b.processors == nil {
+			b.processors = make(map[string][]PostProcessor)
+		}
+		b.processors[t] = pp
+	}
+}
+
+// Imports declares packages, beyond the standard library, that generated Go
+// files may reference and have imported automatically. A package whose name
+// differs from the last element of its path is given as "name path", e.g.
+// "sqlite3 github.com/mattn/go-sqlite3".
+func Imports(paths ...string) BlockOption {
+	return func(b *block) {
+		b.imports = append(b.imports, paths...)
+	}
 }
 
 func NewBlock(t string,
-	f *flag.FlagSet,
+	ps ParamSet,
 	lr Loader,
 	fn map[string]interface{},
 	tm []string,
 	d string,
-	p string) Block {
-	return &block{t, f, []Loader{lr}, fn, tm, d, p}
+	p string,
+	opts ...BlockOption) Block {
+	b := &block{
+		tag:       t,
+		params:    ps,
+		loaders:   []Loader{lr},
+		funcs:     fn,
+		templates: tm,
+		directory: d,
+		pckge:     p,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
 }
 
-func BasicBlock(t string, f *flag.FlagSet, l Loader, tm []string) Block {
-	return NewBlock(t, f, l, nil, tm, ".", "main")
+func BasicBlock(t string, ps ParamSet, l Loader, tm []string, opts ...BlockOption) Block {
+	return NewBlock(t, ps, l, nil, tm, ".", "main", opts...)
 }
 
 func (b *block) Tag() string {
 	return b.tag
 }
 
-func (b *block) Flags() *flag.FlagSet {
-	return b.flags
+func (b *block) Params() ParamSet {
+	return b.params
 }
 
 func (b *block) Loaders() []Loader {
@@ -90,3 +141,19 @@ func (b *block) Directory() string {
 func (b *block) Package() string {
 	return b.pckge
 }
+
+func (b *block) Description() string {
+	return b.description
+}
+
+func (b *block) OutputName(t string) string {
+	return b.outputs[t]
+}
+
+func (b *block) PostProcessors(t string) []PostProcessor {
+	return b.processors[t]
+}
+
+func (b *block) Imports() []string {
+	return b.imports
+}
@@ -0,0 +1,118 @@
+package marid
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+type Describer interface {
+	Description() string
+}
+
+type OutputNamer interface {
+	OutputName(string) string
+}
+
+type BlockInfo struct {
+	Tag         string          `json:"tag"`
+	Description string          `json:"description"`
+	Directory   string          `json:"directory"`
+	Package     string          `json:"package"`
+	Params      []*ParamInfo    `json:"params"`
+	Templates   []*TemplateInfo `json:"templates"`
+}
+
+type ParamInfo struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Default  string   `json:"default"`
+	Usage    string   `json:"usage"`
+	Required bool     `json:"required"`
+	Choices  []string `json:"choices,omitempty"`
+	Derived  string   `json:"derived,omitempty"`
+}
+
+// TemplateInfo describes a template of a block. Pattern is its output name
+// pattern, and Output the path the pattern resolves to with default and
+// derived param values, left empty when those cannot resolve it.
+type TemplateInfo struct {
+	Name       string `json:"name"`
+	Pattern    string `json:"pattern"`
+	Output     string `json:"output,omitempty"`
+	Loader     Loader `json:"-"`
+	LoaderType string `json:"loader"`
+}
+
+// outputName is the default output file name for a template: its lower
+// cased name, keeping any extension other than the .m template extension,
+// or with a .go extension when it has none.
+func outputName(file string) string {
+	name := strings.ToLower(strings.TrimSuffix(file, ".m"))
+	if filepath.Ext(name) == "" {
+		name = fmt.Sprintf("%s.go", name)
+	}
+	return name
+}
+
+func outputPattern(b Block, t string) string {
+	if n, ok := b.(OutputNamer); ok {
+		if p := n.OutputName(t); p != "" {
+			return p
+		}
+	}
+	return outputName(t)
+}
+
+func (b *BlockSet) Info(tag string, loaders ...Loader) (*BlockInfo, error) {
+	bl, err := b.GetBlock(tag)
+	if err != nil {
+		return nil, err
+	}
+	if len(loaders) == 0 {
+		loaders = bl.Loaders()
+	}
+
+	info := &BlockInfo{
+		Tag:       bl.Tag(),
+		Directory: bl.Directory(),
+		Package:   bl.Package(),
+	}
+	if d, ok := bl.(Describer); ok {
+		info.Description = d.Description()
+	}
+
+	for _, p := range bl.Params() {
+		info.Params = append(info.Params, &ParamInfo{
+			Name:     p.Name,
+			Type:     p.Kind.String(),
+			Default:  p.value().String(),
+			Usage:    p.Usage,
+			Required: p.Required,
+			Choices:  p.Choices,
+			Derived:  p.Derive,
+		})
+	}
+
+	for _, t := range bl.Templates() {
+		ti := &TemplateInfo{
+			Name:    t,
+			Pattern: outputPattern(bl, t),
+		}
+		if !strings.Contains(ti.Pattern, "{{") {
+			ti.Output = filepath.Join(bl.Directory(), ti.Pattern)
+		}
+		for _, l := range loaders {
+			if _, lErr := l.Load(t); lErr == nil {
+				ti.Loader, ti.LoaderType = l, fmt.Sprintf("%T", l)
+				break
+			}
+		}
+		if ti.Loader == nil {
+			return nil, NoTemplateError(t)
+		}
+		info.Templates = append(info.Templates, ti)
+	}
+
+	return info, nil
+}
@@ -1,29 +1,27 @@
 package configuration
 
-import (
-	"flag"
-	"strings"
-
-	"github.com/thrisp/marid"
-)
+import "github.com/thrisp/marid"
 
 var Block marid.Block = marid.BasicBlock(
 	"configuration",
-	mkFlagSet(),
+	params,
 	cl,
 	[]string{"configuration"},
+	marid.Description("ordered configuration functions for a type"),
 )
 
-var (
-	Configurable string
-	Letter       string
-)
+// declared are the identifiers the template declares where the configured
+// type and its receiver name are in scope, which they may not reuse.
+var declared = []string{
+	"Config", "ConfigFn", "Configuration", "DefaultConfig", "NewConfig",
+	"builtIns", "cf", "cfg", "conf", "config", "configList",
+	"configuration", "configure", "err", "fn", "fns", "newConfiguration",
+	"sort",
+}
 
-func mkFlagSet() *flag.FlagSet {
-	ret := flag.NewFlagSet("configuration", flag.PanicOnError)
-	ret.StringVar(&Configurable, "Configurable", "Configurable", "")
-	ret.StringVar(&Letter, "Letter", strings.ToLower(string(Configurable[0:1])), "")
-	return ret
+var params marid.ParamSet = marid.ParamSet{
+	marid.StringParam("Configurable", "", "name of the type being configured").Require().Validate(marid.Identifier, marid.NoneOf(declared...)),
+	marid.StringParam("Letter", "", "receiver name for the configured type").DeriveFrom("{{ lower (first .Configurable) }}").Validate(marid.Identifier, marid.NoneOf(declared...)),
 }
 
 var cl marid.Loader = marid.MapLoader(cm)
@@ -59,12 +57,12 @@ func NewConfig(order int, fn ConfigFn) Config {
 	return config{order, fn}
 }
 
-func (c config) Order() int {
-	return c.order
+func (cf config) Order() int {
+	return cf.order
 }
 
-func (c config) Configure({{.Letter}} *{{.Configurable}}) error {
-	return c.fn(m)
+func (cf config) Configure({{.Letter}} *{{.Configurable}}) error {
+	return cf.fn({{.Letter}})
 }
 
 type configList []Config
@@ -95,27 +93,27 @@ type configuration struct {
 }
 
 func newConfiguration({{.Letter}} *{{.Configurable}}, conf ...Config) *configuration {
-	c := &configuration{
-		m:    m,
+	cfg := &configuration{
+		{{.Letter}}: {{.Letter}},
 		list: builtIns,
 	}
-	c.Add(conf...)
-	return c
+	cfg.Add(conf...)
+	return cfg
 }
 
-func (c *configuration) Add(conf ...Config) {
-	c.list = append(c.list, conf...)
+func (cfg *configuration) Add(conf ...Config) {
+	cfg.list = append(cfg.list, conf...)
 }
 
-func (c *configuration) AddFn(fns ...ConfigFn) {
+func (cfg *configuration) AddFn(fns ...ConfigFn) {
 	for _, fn := range fns {
-		c.list = append(c.list, DefaultConfig(fn))
+		cfg.list = append(cfg.list, DefaultConfig(fn))
 	}
 }
 
 func configure({{.Letter}} *{{.Configurable}}, conf ...Config) error {
-	for _, c := range conf {
-		err := c.Configure({{.Letter}})
+	for _, cf := range conf {
+		err := cf.Configure({{.Letter}})
 		if err != nil {
 			return err
 		}
@@ -123,19 +121,19 @@ func configure({{.Letter}} *{{.Configurable}}, conf ...Config) error {
 	return nil
 }
 
-func (c *configuration) Configure() error {
-	sort.Sort(c.list)
+func (cfg *configuration) Configure() error {
+	sort.Sort(cfg.list)
 
-	err := configure(c.{{.Letter}}, c.list...)
+	err := configure(cfg.{{.Letter}}, cfg.list...)
 	if err == nil {
-		c.configured = true
+		cfg.configured = true
 	}
 
 	return err
 }
 
-func (c *configuration) Configured() bool {
-	return c.configured
+func (cfg *configuration) Configured() bool {
+	return cfg.configured
 }
 
 var builtIns = []Config{
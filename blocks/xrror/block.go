@@ -1,31 +1,19 @@
 package xrror
 
-import (
-	"flag"
-	"strings"
-
-	"github.com/thrisp/marid"
-)
+import "github.com/thrisp/marid"
 
 var Block marid.Block = marid.BasicBlock(
 	"xrror",
-	mkFlagSet(),
+	params,
 	xl,
 	[]string{"xrror"},
+	marid.Description("an error type with a formatting constructor"),
 )
 
-var (
-	ErrorName         string
-	Letter            string
-	ErrorFunctionName string
-)
-
-func mkFlagSet() *flag.FlagSet {
-	ret := flag.NewFlagSet("xrror", flag.PanicOnError)
-	ret.StringVar(&ErrorName, "ErrorName", "xrror", "")
-	ret.StringVar(&Letter, "Letter", strings.ToLower(string(ErrorName[0])), "")
-	ret.StringVar(&ErrorFunctionName, "ErrorFunctionName", "Xrror", "")
-	return ret
+var params marid.ParamSet = marid.ParamSet{
+	marid.StringParam("ErrorName", "", "name of the error type").Require().Validate(marid.Identifier),
+	marid.StringParam("Letter", "", "receiver name for the error type methods").DeriveFrom("{{ lower (first .ErrorName) }}").Validate(marid.Identifier),
+	marid.StringParam("ErrorFunctionName", "Xrror", "name of the error constructor").Validate(marid.Identifier),
 }
 
 var xl marid.Loader = marid.MapLoader(em)
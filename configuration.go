@@ -1,6 +1,8 @@
 package marid
 
 import (
+	"io"
+	"os"
 	"sort"
 )
 
@@ -89,13 +91,17 @@ func configure(m *manager, conf ...Config) error {
 }
 
 func (c *configuration) Configure() error {
-	DefaultLogr.PrintIf("configuring...")
+	if c.m.verbose {
+		DefaultLogr.PrintIf("configuring...")
+	}
 	sort.Sort(c.list)
 
 	err := configure(c.m, c.list...)
 	if err == nil {
 		c.configured = true
-		DefaultLogr.PrintIf("configured")
+		if c.m.verbose {
+			DefaultLogr.PrintIf("configured")
+		}
 	}
 
 	return err
@@ -108,6 +114,7 @@ func (c *configuration) Configured() bool {
 var builtIns = []Config{
 	config{1000, setBufferPool},
 	config{1001, setLogger},
+	config{1002, setSink},
 }
 
 func setBufferPool(m *manager) error {
@@ -124,6 +131,20 @@ func setLogger(m *manager) error {
 	return nil
 }
 
+func setSink(m *manager) error {
+	if m.sink == nil {
+		m.sink = FileSink()
+	}
+	return nil
+}
+
+func Version(v string) Config {
+	return DefaultConfig(func(m *manager) error {
+		m.version = v
+		return nil
+	})
+}
+
 func Verbose(is bool) Config {
 	return DefaultConfig(func(m *manager) error {
 		m.verbose = is
@@ -131,6 +152,77 @@ func Verbose(is bool) Config {
 	})
 }
 
+func DryRun(w io.Writer) Config {
+	return DefaultConfig(func(m *manager) error {
+		m.dryRun = true
+		if w == nil {
+			w = os.Stdout
+		}
+		m.output = w
+		return nil
+	})
+}
+
+func Diff(w io.Writer) Config {
+	return DefaultConfig(func(m *manager) error {
+		m.diff = true
+		if w == nil {
+			w = os.Stdout
+		}
+		m.output = w
+		return nil
+	})
+}
+
+func Force(is bool) Config {
+	return DefaultConfig(func(m *manager) error {
+		m.force = is
+		return nil
+	})
+}
+
+func Merge(is bool) Config {
+	return DefaultConfig(func(m *manager) error {
+		m.merge = is
+		return nil
+	})
+}
+
+func Prune(is bool) Config {
+	return DefaultConfig(func(m *manager) error {
+		m.prune = is
+		return nil
+	})
+}
+
+func TypeCheck(is bool) Config {
+	return DefaultConfig(func(m *manager) error {
+		m.typeCheck = is
+		return nil
+	})
+}
+
+func Sink(s OutputSink) Config {
+	return DefaultConfig(func(m *manager) error {
+		m.sink = s
+		return nil
+	})
+}
+
+func FileMode(mode os.FileMode) Config {
+	return DefaultConfig(func(m *manager) error {
+		m.fileMode = mode
+		return nil
+	})
+}
+
+func LockFile(path string) Config {
+	return DefaultConfig(func(m *manager) error {
+		m.lockFile = path
+		return nil
+	})
+}
+
 func Loaders(l ...Loader) Config {
 	return DefaultConfig(func(m *manager) error {
 		m.AddLoaders(l...)
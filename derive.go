@@ -0,0 +1,44 @@
+package marid
+
+import (
+	"flag"
+	"text/template"
+)
+
+func (m *manager) derive(fs *flag.FlagSet, set map[string]bool) error {
+	data := make(map[string]interface{})
+	var derived []*paramValue
+	fs.VisitAll(func(fl *flag.Flag) {
+		data[fl.Name] = flagValue(fl)
+		if pv, ok := fl.Value.(*paramValue); ok && pv.param.Derive != "" && !set[fl.Name] {
+			derived = append(derived, pv)
+		}
+	})
+
+	// derived params may depend on each other, so resolve in passes until
+	// every chain has settled
+	b := m.get()
+	defer m.put(b)
+	for pass, changed := 0, true; pass < len(derived) && changed; pass++ {
+		changed = false
+		for _, pv := range derived {
+			t, err := template.New(pv.param.Name).Funcs(m.GetFuncs()).Parse(pv.param.Derive)
+			if err != nil {
+				return DeriveError(pv.param.Name, err)
+			}
+			b.Reset()
+			if err := t.Execute(b, data); err != nil {
+				return DeriveError(pv.param.Name, err)
+			}
+			// a derived value replaces the last pass rather than adding to it
+			before := pv.String()
+			pv.replaced = false
+			if err := pv.Set(b.String()); err != nil {
+				return DeriveError(pv.param.Name, err)
+			}
+			changed = changed || pv.String() != before
+			data[pv.param.Name] = pv.Get()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package marid
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func derivedValues(t *testing.T, ps ParamSet, args ...string) map[string]interface{} {
+	m := New(LockFile("")).(*manager)
+	m.Configure()
+	fs, err := ps.FlagSet("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	if err := m.derive(fs, set); err != nil {
+		t.Fatal(err)
+	}
+	ret := make(map[string]interface{})
+	fs.VisitAll(func(fl *flag.Flag) { ret[fl.Name] = flagValue(fl) })
+	return ret
+}
+
+func TestDeriveListAndMap(t *testing.T) {
+	ps := ParamSet{
+		StringParam("Name", "", ""),
+		StringParam("Lower", "", "").DeriveFrom("{{ lower .Name }}"),
+		ListParam("Tags", []string{"default"}, "").DeriveFrom("{{ .Lower }},x"),
+		MapParam("Labels", nil, "").DeriveFrom("name={{ .Lower }},kind=x"),
+	}
+	values := derivedValues(t, ps, "-Name=Alpha")
+	expect := map[string]interface{}{
+		"Name":   "Alpha",
+		"Lower":  "alpha",
+		"Tags":   []string{"alpha", "x"},
+		"Labels": map[string]string{"name": "alpha", "kind": "x"},
+	}
+	if !reflect.DeepEqual(values, expect) {
+		t.Errorf("derived %#v, expected %#v", values, expect)
+	}
+}
+
+func TestDeriveKeepsSetValues(t *testing.T) {
+	ps := ParamSet{
+		StringParam("Name", "", ""),
+		StringParam("Letter", "", "").DeriveFrom("{{ lower (first .Name) }}"),
+		ListParam("Tags", nil, "").DeriveFrom("{{ .Letter }}"),
+	}
+	values := derivedValues(t, ps, "-Name=Alpha", "-Tags=a", "-Tags=b,c")
+	if values["Letter"] != "a" {
+		t.Errorf("Letter derived as %v, expected a", values["Letter"])
+	}
+	if tags := values["Tags"]; !reflect.DeepEqual(tags, []string{"a", "b", "c"}) {
+		t.Errorf("Tags were %v, expected the values set", tags)
+	}
+}
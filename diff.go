@@ -0,0 +1,114 @@
+package marid
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+type diffLine struct {
+	kind byte
+	text string
+	a, b int
+}
+
+func splitLines(src []byte) []string {
+	s := string(src)
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ret []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ret = append(ret, diffLine{' ', a[i], i, j})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			ret = append(ret, diffLine{'+', b[j], i, j})
+			j++
+		default:
+			ret = append(ret, diffLine{'-', a[i], i, j})
+			i++
+		}
+	}
+	return ret
+}
+
+func hunkStart(pos, count int) int {
+	if count == 0 {
+		return pos
+	}
+	return pos + 1
+}
+
+func unifiedDiff(from, to string, a, b []byte) []byte {
+	lines := diffLines(splitLines(a), splitLines(b))
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", from, to)
+
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		last := i
+		for j := i; j < len(lines) && j-last <= 2*diffContext; j++ {
+			if lines[j].kind != ' ' {
+				last = j
+			}
+		}
+		stop := last + diffContext + 1
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+
+		var aCount, bCount int
+		for _, l := range lines[start:stop] {
+			if l.kind != '+' {
+				aCount++
+			}
+			if l.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n",
+			hunkStart(lines[start].a, aCount), aCount,
+			hunkStart(lines[start].b, bCount), bCount)
+		for _, l := range lines[start:stop] {
+			fmt.Fprintf(&buf, "%c%s\n", l.kind, l.text)
+		}
+
+		i = stop
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,197 @@
+package marid
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type Params map[string]interface{}
+
+// ParamsFrom converts the exported fields of a struct into Params, naming
+// each param by its `marid` field tag or the field name. Fields holding
+// their zero value, or an empty slice or map, are left out so that params
+// keep their defaults and derivations; use Params directly to set a param
+// to a zero value.
+func ParamsFrom(v interface{}) (Params, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%T is not a struct", v)
+	}
+	ret := make(Params)
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("marid"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		if fv := rv.Field(i); !zero(fv) {
+			ret[name] = fv.Interface()
+		}
+	}
+	return ret, nil
+}
+
+func zero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+type DoOption func(*request)
+
+func InDirectory(dir string) DoOption {
+	return func(r *request) {
+		r.dir = dir
+	}
+}
+
+func InPackage(pkg string) DoOption {
+	return func(r *request) {
+		r.pkg = pkg
+	}
+}
+
+type request struct {
+	ctx    context.Context
+	block  string
+	args   []string
+	params Params
+	dir    string
+	pkg    string
+}
+
+func newRequest(ctx context.Context, bl string, args []string, params Params, opts ...DoOption) *request {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	r := &request{ctx: ctx, block: bl, args: args, params: params}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+var reservedParams = []string{"dir", "package"}
+
+func reserved(name string) bool {
+	return contains(reservedParams, name)
+}
+
+func (r *request) apply(fs *flag.FlagSet) (map[string]bool, error) {
+	for _, name := range reservedParams {
+		if fs.Lookup(name) != nil {
+			return nil, ParamError(r.block, fmt.Sprintf("param name %s is reserved", name))
+		}
+	}
+	dir := fs.String("dir", "", "output directory, overriding the block directory")
+	pkg := fs.String("package", "", "package name, overriding the detected or block package")
+
+	if err := fs.Parse(r.args); err != nil {
+		return nil, ParamError(r.block, err)
+	}
+	if *dir != "" {
+		r.dir = *dir
+	}
+	if *pkg != "" {
+		r.pkg = *pkg
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) {
+		if !reserved(fl.Name) {
+			set[fl.Name] = true
+		}
+	})
+	for name, v := range r.params {
+		fl := fs.Lookup(name)
+		if fl == nil || reserved(name) {
+			return nil, ParamError(r.block, fmt.Sprintf("no param named %s", name))
+		}
+		var err error
+		if pv, ok := fl.Value.(*paramValue); ok {
+			err = pv.assign(v)
+		} else {
+			err = fl.Value.Set(fmt.Sprint(v))
+		}
+		if err != nil {
+			return nil, ParamError(r.block, fmt.Sprintf("%s: %s", name, err))
+		}
+		set[name] = true
+	}
+	return set, nil
+}
+
+func (v *paramValue) assign(val interface{}) error {
+	if s, ok := val.(string); ok {
+		return v.Set(s)
+	}
+	ok := false
+	switch v.param.Kind {
+	case BoolKind:
+		_, ok = val.(bool)
+	case IntKind:
+		switch i := val.(type) {
+		case int:
+			ok = true
+		case int32:
+			val, ok = int(i), true
+		case int64:
+			val, ok = int(i), true
+		}
+	case DurationKind:
+		_, ok = val.(time.Duration)
+	case ListKind:
+		var l []string
+		if l, ok = val.([]string); ok {
+			val = append([]string(nil), l...)
+		}
+	case MapKind:
+		var mp map[string]string
+		if mp, ok = val.(map[string]string); ok {
+			cp := make(map[string]string)
+			for k, mv := range mp {
+				cp[k] = mv
+			}
+			val = cp
+		}
+	}
+	if !ok {
+		return fmt.Errorf("%v (%T) is not a %s value", val, val, v.param.Kind)
+	}
+	v.value, v.replaced = val, true
+	return nil
+}
+
+type Result struct {
+	Block     string
+	Directory string
+	Package   string
+	Files     []*GeneratedFile
+	Pruned    []string
+}
+
+type GeneratedFile struct {
+	Template string
+	Path     string
+	Source   []byte
+}
+
+func (m *manager) DoWith(ctx context.Context, bl string, p Params, opts ...DoOption) (*Result, error) {
+	m.PrintIf("Doing block %s with params %v", bl, p)
+	return m.do(newRequest(ctx, bl, nil, p, opts...))
+}
@@ -0,0 +1,50 @@
+package marid
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParamsFrom(t *testing.T) {
+	type spec struct {
+		Name    string
+		Letter  string
+		Tags    []string `marid:"Labels"`
+		Count   int
+		Skipped string `marid:"-"`
+		hidden  string
+	}
+	params, err := ParamsFrom(spec{Name: "Thing", Tags: []string{"a"}, Skipped: "x", hidden: "y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := Params{"Name": "Thing", "Labels": []string{"a"}}
+	if !reflect.DeepEqual(params, expect) {
+		t.Errorf("params %v, expected %v", params, expect)
+	}
+
+	if _, err := ParamsFrom("not a struct"); err == nil {
+		t.Error("expected an error for a non struct")
+	}
+}
+
+func TestParamsFromKeepsDerivations(t *testing.T) {
+	l := MapLoader(map[string]string{"t": `{{ extends "block_base" }}{{ define "block_root" }}package p
+
+func ({{ .Letter }} *{{ .Name }}) M() {}
+{{ end }}`})
+	ps := ParamSet{
+		StringParam("Name", "", "").Require(),
+		StringParam("Letter", "", "").DeriveFrom("{{ lower (first .Name) }}").Validate(Identifier),
+	}
+	m := New(Blocks(BasicBlock("t", ps, l, []string{"t"})), Sink(NewMemorySink()), LockFile("")).(*manager)
+	m.Configure()
+	params, err := ParamsFrom(struct{ Name, Letter string }{Name: "Thing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.DoWith(context.Background(), "t", params); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,6 +1,9 @@
 package marid
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+)
 
 type maridError struct {
 	err  string
@@ -28,4 +31,33 @@ var (
 	RenderError        = Mrror("render error: %s").Out
 	InvalidGoCodeError = Mrror("error formatting go code: invalid Go generated: %s\ncompile the package to analyze the error").Out
 	NoBlockError       = Mrror("no block named %s available").Out
+	DeriveError        = Mrror("could not derive param %s: %s").Out
+	DiffError          = Mrror("generated output for %s differs from files on disk").Out
+	RegionError        = Mrror("protected region error in %s: %s").Out
+	MergeConflictError = Mrror("merge conflicts written to %s").Out
+	LockError          = Mrror("lock file %s: %s").Out
+	PruneError         = Mrror("prune error: %s").Out
+	ParamError         = Mrror("params for block %s: %s").Out
+	OutputNameError    = Mrror("output name for template %s: %s").Out
+	DirectiveError     = Mrror("%s: %s").Out
+	ReferenceError     = Mrror("%s: template %q is not defined").Out
+	OverwriteError     = Mrror("refusing to overwrite %s: file was not generated by marid (use force to overwrite)").Out
 )
+
+type StaleError struct {
+	Block   string
+	Stale   []string
+	Missing []string
+}
+
+func (s *StaleError) Error() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "generated files for block %s are out of date", s.Block)
+	for _, f := range s.Stale {
+		fmt.Fprintf(&b, "\n\tstale: %s", f)
+	}
+	for _, f := range s.Missing {
+		fmt.Fprintf(&b, "\n\tmissing: %s", f)
+	}
+	return b.String()
+}
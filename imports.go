@@ -0,0 +1,225 @@
+package marid
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ImportDeclarer interface {
+	Imports() []string
+}
+
+var reImportRequest *regexp.Regexp = regexp.MustCompile(`/\*marid:import ("(?:[^"\\]|\\.)*")(?: as (\w+))?\*/`)
+
+// importRequest is the template function behind {{ import "path" }}, with an
+// optional alias. It leaves a comment that ManageImports moves into the
+// import declaration of the file.
+func importRequest(p string, alias ...string) string {
+	if len(alias) > 0 && alias[0] != "" {
+		return fmt.Sprintf("/*marid:import %q as %s*/", p, alias[0])
+	}
+	return fmt.Sprintf("/*marid:import %q*/", p)
+}
+
+var reMajorVersion *regexp.Regexp = regexp.MustCompile(`^v[0-9]+$`)
+
+// goImport is an import path with its alias, if any, and the name of the
+// package it imports when that is known rather than guessed from its path.
+type goImport struct {
+	name string
+	path string
+	pkg  string
+}
+
+// knownImport reads a known package, given as a path or as a package name
+// and path separated by a space for packages not named after their path.
+func knownImport(k string) goImport {
+	if f := strings.Fields(k); len(f) == 2 {
+		return goImport{path: f[1], pkg: f[0]}
+	}
+	return goImport{path: k}
+}
+
+func (i goImport) local() string {
+	switch {
+	case i.name != "":
+		return i.name
+	case i.pkg != "":
+		return i.pkg
+	}
+	name := path.Base(i.path)
+	if dir := path.Dir(i.path); reMajorVersion.MatchString(name) && dir != "." {
+		name = path.Base(dir)
+	}
+	if n := strings.IndexAny(name, ".-"); n > 0 {
+		name = name[:n]
+	}
+	return name
+}
+
+// certain reports whether the local name of an import is known, so that it
+// can safely be removed when that name is unused.
+func (i goImport) certain() bool {
+	return i.name != "" || i.pkg != "" || standard(i.path)
+}
+
+func (i goImport) String() string {
+	if i.name != "" {
+		return fmt.Sprintf("%s %q", i.name, i.path)
+	}
+	return strconv.Quote(i.path)
+}
+
+func standard(p string) bool {
+	return !strings.Contains(strings.SplitN(p, "/", 2)[0], ".")
+}
+
+// ManageImports returns a post processor that adds imports for referenced
+// standard library packages and the known packages given, adds imports
+// requested from templates, removes unused imports and groups the rest.
+func ManageImports(known ...string) PostProcessor {
+	return func(name string, src []byte) ([]byte, error) {
+		return manageImports(name, src, known)
+	}
+}
+
+func manageImports(name string, src []byte, known []string) ([]byte, error) {
+	var requested []goImport
+	var reqErr error
+	src = reImportRequest.ReplaceAllFunc(src, func(m []byte) []byte {
+		sub := reImportRequest.FindSubmatch(m)
+		p, err := strconv.Unquote(string(sub[1]))
+		if err != nil {
+			reqErr = err
+		}
+		requested = append(requested, goImport{name: string(sub[2]), path: p})
+		return nil
+	})
+	if reqErr != nil {
+		return nil, InvalidGoCodeError(reqErr)
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+	if err != nil {
+		return nil, goSourceError(name, src, err)
+	}
+
+	named := make(map[string]string)
+	for _, k := range known {
+		if i := knownImport(k); i.pkg != "" {
+			named[i.path] = i.pkg
+		}
+	}
+
+	imports := make(map[string]goImport)
+	for _, is := range f.Imports {
+		p, _ := strconv.Unquote(is.Path.Value)
+		i := goImport{path: p, pkg: named[p]}
+		if is.Name != nil {
+			i.name = is.Name.Name
+		}
+		imports[i.String()] = i
+	}
+	for _, i := range requested {
+		i.pkg = named[i.path]
+		imports[i.String()] = i
+	}
+
+	used := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+
+	have := make(map[string]bool)
+	for _, i := range imports {
+		have[i.local()] = true
+	}
+	candidates := make(map[string]string)
+	for n, p := range stdlib {
+		candidates[n] = p
+	}
+	for _, k := range known {
+		i := knownImport(k)
+		candidates[i.local()] = i.path
+	}
+	for n := range used {
+		if p, ok := candidates[n]; ok && !have[n] {
+			imports[strconv.Quote(p)] = goImport{path: p, pkg: named[p]}
+		}
+	}
+
+	var std, other []string
+	for k, i := range imports {
+		// an import whose package name is only guessed from its path is
+		// kept, as the guess may be wrong
+		if l := i.local(); l != "_" && l != "." && !used[l] && i.certain() {
+			continue
+		}
+		if standard(i.path) {
+			std = append(std, k)
+		} else {
+			other = append(other, k)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+
+	var decl bytes.Buffer
+	if len(std)+len(other) > 0 {
+		decl.WriteString("import (\n")
+		for _, k := range std {
+			fmt.Fprintf(&decl, "\t%s\n", k)
+		}
+		if len(std) > 0 && len(other) > 0 {
+			decl.WriteString("\n")
+		}
+		for _, k := range other {
+			fmt.Fprintf(&decl, "\t%s\n", k)
+		}
+		decl.WriteString(")\n")
+	}
+
+	// cut every existing import declaration, placing the new one where the
+	// first was, or after the package clause
+	insert := fset.Position(f.Name.End()).Offset
+	var b bytes.Buffer
+	last := 0
+	placed := false
+	for _, d := range f.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			continue
+		}
+		start, end := fset.Position(gd.Pos()).Offset, fset.Position(gd.End()).Offset
+		b.Write(src[last:start])
+		if !placed {
+			b.Write(decl.Bytes())
+			placed = true
+		}
+		last = end
+	}
+	if placed {
+		b.Write(src[last:])
+	} else {
+		b.Write(src[:insert])
+		b.WriteString("\n\n")
+		b.Write(decl.Bytes())
+		b.Write(src[insert:])
+	}
+
+	return Gofmt(name, b.Bytes())
+}
@@ -0,0 +1,62 @@
+package marid
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestManageImports(t *testing.T) {
+	cases := []struct {
+		name    string
+		src     string
+		known   []string
+		keep    []string
+		removed []string
+	}{
+		{
+			"guessed names are kept",
+			"package p\n\nimport (\n\t\"github.com/foo/bar/v2\"\n\t\"github.com/mattn/go-sqlite3\"\n)\n\nvar _ = bar.X\nvar _ = sqlite3.Y\n",
+			nil,
+			[]string{`"github.com/foo/bar/v2"`, `"github.com/mattn/go-sqlite3"`},
+			nil,
+		},
+		{
+			"known names are removed when unused",
+			"package p\n\nimport (\n\t\"github.com/foo/bar/v2\"\n\t\"github.com/mattn/go-sqlite3\"\n\t\"strings\"\n)\n\nvar _ = bar.X\n",
+			[]string{"bar github.com/foo/bar/v2", "sqlite3 github.com/mattn/go-sqlite3"},
+			[]string{`"github.com/foo/bar/v2"`},
+			[]string{"go-sqlite3", `"strings"`},
+		},
+		{
+			"aliases are removed when unused",
+			"package p\n\nimport (\n\tb \"github.com/foo/bar/v2\"\n\tsq \"github.com/mattn/go-sqlite3\"\n)\n\nvar _ = sq.Y\n",
+			nil,
+			[]string{`sq "github.com/mattn/go-sqlite3"`},
+			[]string{"bar/v2"},
+		},
+		{
+			"major version paths are added by the element before the version",
+			"package p\n\nvar _ = bar.X\nvar _ = sqlite3.Y\nvar _ = strings.ToUpper\n",
+			[]string{"github.com/foo/bar/v2", "sqlite3 github.com/mattn/go-sqlite3"},
+			[]string{`"github.com/foo/bar/v2"`, `"github.com/mattn/go-sqlite3"`, `"strings"`},
+			nil,
+		},
+	}
+	for _, c := range cases {
+		out, err := manageImports("p.go", []byte(c.src), c.known)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		for _, k := range c.keep {
+			if !strings.Contains(string(out), k) {
+				t.Errorf("%s: %s missing from\n%s", c.name, k, out)
+			}
+		}
+		for _, r := range c.removed {
+			if strings.Contains(string(out), r) {
+				t.Errorf("%s: %s not removed from\n%s", c.name, r, out)
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package marid
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -128,10 +129,20 @@ func (l *mapLoader) ListTemplates() []string {
 var baseLoader Loader = MapLoader(cl)
 
 var cl map[string]string = map[string]string{
-	"block_base": base,
+	"block_base":      base,
+	"block_base_hash": commentBase("#", ""),
+	"block_base_dash": commentBase("--", ""),
+	"block_base_html": commentBase("<!--", " -->"),
 }
 
-var base string = `// block {{ .Block }} created by Marid
-// edit at your own risk!
-{{ template "block_root" }}
-`
+func commentBase(prefix, suffix string) string {
+	return fmt.Sprintf(`%s Code generated by marid {{ .MaridVersion }} from block {{ .Block }}{{ with .MaridFlags }} with flags {{ . }}{{ end }}. DO NOT EDIT.%s
+{{ template "block_header" . }}
+{{ template "block_root" . }}
+{{ define "block_header" }}{{ end }}`, prefix, suffix)
+}
+
+var base string = `// Code generated by marid {{ .MaridVersion }} from block {{ .Block }}{{ with .MaridFlags }} with flags {{ . }}{{ end }}. DO NOT EDIT.
+{{ template "block_header" . }}
+{{ template "block_root" . }}
+{{ define "block_header" }}{{ end }}`
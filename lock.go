@@ -0,0 +1,273 @@
+package marid
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"text/template"
+	"text/template/parse"
+)
+
+type Lock struct {
+	Version string       `json:"version"`
+	Entries []*LockEntry `json:"entries"`
+}
+
+type LockEntry struct {
+	Block     string            `json:"block"`
+	Directory string            `json:"directory"`
+	Package   string            `json:"package"`
+	Flags     map[string]string `json:"flags"`
+	Templates []*LockTemplate   `json:"templates"`
+	Outputs   []*LockOutput     `json:"outputs"`
+	Version   string            `json:"version"`
+}
+
+type LockTemplate struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+}
+
+type LockOutput struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+// newLockEntry records a generation with the params the caller set, so that
+// replaying it leaves defaults and derived params to be worked out again.
+func newLockEntry(tag, dir, pkg string, fs *flag.FlagSet, set map[string]bool, version string) *LockEntry {
+	e := &LockEntry{
+		Block:     tag,
+		Directory: dir,
+		Package:   pkg,
+		Flags:     make(map[string]string),
+		Version:   version,
+	}
+	fs.VisitAll(func(fl *flag.Flag) {
+		if set[fl.Name] && !reserved(fl.Name) {
+			e.Flags[fl.Name] = fl.Value.String()
+		}
+	})
+	return e
+}
+
+func (e *LockEntry) Args() []string {
+	var names []string
+	for k := range e.Flags {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var ret []string
+	for _, k := range names {
+		ret = append(ret, fmt.Sprintf("-%s=%s", k, e.Flags[k]))
+	}
+	return ret
+}
+
+func hashBytes(b []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b))
+}
+
+func (m *manager) templateHash(t string) (string, error) {
+	stack, err := m.nodes(t)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, node := range stack {
+		fmt.Fprintf(h, "%s\x00%s\x00", node.Name, node.Src)
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// naming returns the params the output name patterns of a block refer to,
+// along with the params any derived ones among them are derived from.
+func (m *manager) naming(b Block) []string {
+	var queue []string
+	for _, t := range b.Templates() {
+		queue = append(queue, m.referenced(t, outputPattern(b, t))...)
+	}
+	derived := make(map[string]string)
+	for _, p := range b.Params() {
+		derived[p.Name] = p.Derive
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+		if d := derived[name]; d != "" {
+			queue = append(queue, m.referenced(name, d)...)
+		}
+	}
+	return names
+}
+
+// referenced returns the fields of the template data a template refers to.
+func (m *manager) referenced(name, src string) []string {
+	nt, err := template.New(name).Funcs(m.GetFuncs()).Parse(src)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	walk(nt.Tree.Root, func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ActionNode:
+			names = append(names, fields(n.Pipe)...)
+		case *parse.IfNode:
+			names = append(names, fields(n.Pipe)...)
+		case *parse.RangeNode:
+			names = append(names, fields(n.Pipe)...)
+		case *parse.WithNode:
+			names = append(names, fields(n.Pipe)...)
+		}
+	})
+	return names
+}
+
+func fields(p *parse.PipeNode) []string {
+	var names []string
+	for _, cmd := range p.Cmds {
+		for _, arg := range cmd.Args {
+			switch arg := arg.(type) {
+			case *parse.FieldNode:
+				names = append(names, arg.Ident[0])
+			case *parse.PipeNode:
+				names = append(names, fields(arg)...)
+			}
+		}
+	}
+	return names
+}
+
+// sameVariant reports whether two entries record the same invocation of a
+// block: the same block and directory, with the same values for the params
+// that shape its output names.
+func (m *manager) sameVariant(a, b *LockEntry) bool {
+	if a.Block != b.Block || filepath.Clean(a.Directory) != filepath.Clean(b.Directory) {
+		return false
+	}
+	blk, err := m.GetBlock(a.Block)
+	if err != nil {
+		return reflect.DeepEqual(a.Flags, b.Flags)
+	}
+	for _, name := range m.naming(blk) {
+		if a.Flags[name] != b.Flags[name] {
+			return false
+		}
+	}
+	return true
+}
+
+func overlaps(a, b *LockEntry) bool {
+	paths := make(map[string]bool)
+	for _, o := range a.Outputs {
+		paths[filepath.Clean(o.Path)] = true
+	}
+	for _, o := range b.Outputs {
+		if paths[filepath.Clean(o.Path)] {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *manager) readLock() (*Lock, error) {
+	l := &Lock{}
+	src, err := m.existing(m.lockFile)
+	switch {
+	case os.IsNotExist(err):
+		return l, nil
+	case err != nil:
+		return nil, LockError(m.lockFile, err)
+	}
+	if err := json.Unmarshal(src, l); err != nil {
+		return nil, LockError(m.lockFile, err)
+	}
+	return l, nil
+}
+
+func (m *manager) lock(e *LockEntry) error {
+	if m.lockFile == "" {
+		return nil
+	}
+	l, err := m.readLock()
+	if err != nil {
+		return err
+	}
+	l.Version = m.version
+
+	var entries []*LockEntry
+	replaced := false
+	for _, existing := range l.Entries {
+		switch {
+		case !m.sameVariant(existing, e) && !overlaps(existing, e):
+			entries = append(entries, existing)
+		case !replaced:
+			entries, replaced = append(entries, e), true
+		}
+	}
+	if !replaced {
+		entries = append(entries, e)
+	}
+	l.Entries = entries
+
+	src, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return LockError(m.lockFile, err)
+	}
+	src = append(src, '\n')
+
+	f, err := m.sink.Open(m.lockFile, m.fileMode)
+	if err != nil {
+		return LockError(m.lockFile, err)
+	}
+	if _, err := f.Write(src); err != nil {
+		f.Discard()
+		return LockError(m.lockFile, err)
+	}
+	if err := f.Commit(); err != nil {
+		return LockError(m.lockFile, err)
+	}
+	return nil
+}
+
+func (m *manager) Regen() error {
+	m.PrintIf("Regenerating from %s", m.lockFile)
+	if m.lockFile == "" {
+		return LockError("(none)", "lock file disabled")
+	}
+	l, err := m.readLock()
+	if err != nil {
+		return err
+	}
+	if len(l.Entries) == 0 {
+		return LockError(m.lockFile, "no entries to regenerate")
+	}
+	for _, e := range l.Entries {
+		for _, t := range e.Templates {
+			hash, hErr := m.templateHash(t.Name)
+			if hErr != nil {
+				return hErr
+			}
+			if hash != t.Hash {
+				m.Printf("warning: template %s for block %s changed since %s was written", t.Name, e.Block, m.lockFile)
+			}
+		}
+		r := newRequest(nil, e.Block, e.Args(), nil, InDirectory(e.Directory), InPackage(e.Package))
+		if _, dErr := m.do(r); dErr != nil {
+			return dErr
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package marid
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLockKeepsVariants(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	m := variantManager(dir, "t")
+	for _, name := range []string{"Alpha", "Beta", "Alpha"} {
+		if _, err := m.DoWith(context.Background(), "variant", Params{"Name": name}, InDirectory(dir)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l, err := m.readLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range l.Entries {
+		names = append(names, e.Flags["Name"])
+	}
+	if len(names) != 2 || names[0] != "Alpha" || names[1] != "Beta" {
+		t.Errorf("lock entries for %v, expected [Alpha Beta]", names)
+	}
+	if err := m.CheckLock(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLockRecordsSetParams(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	l := MapLoader(map[string]string{"t": `{{ extends "block_base" }}{{ define "block_root" }}package p
+
+const {{ .Name }} = "{{ .Lower }}{{ .Mode }}"
+{{ end }}`})
+	ps := ParamSet{
+		StringParam("Name", "", "").Require(),
+		StringParam("Lower", "", "").DeriveFrom("{{ lower .Name }}"),
+		EnumParam("Mode", "", "", "a", "b"),
+	}
+	blk := BasicBlock("set", ps, l, []string{"t"})
+	m := New(Blocks(blk), LockFile(filepath.Join(dir, "marid.lock"))).(*manager)
+	m.Configure()
+	if _, err := m.DoWith(context.Background(), "set", Params{"Name": "Alpha"}, InDirectory(dir)); err != nil {
+		t.Fatal(err)
+	}
+	lk, err := m.readLock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags := lk.Entries[0].Flags; !reflect.DeepEqual(flags, map[string]string{"Name": "Alpha"}) {
+		t.Errorf("recorded flags %v, expected only Name", flags)
+	}
+	if err := m.Regen(); err != nil {
+		t.Error(err)
+	}
+}
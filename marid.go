@@ -1,11 +1,11 @@
 package marid
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"go/format"
-	"io/ioutil"
+	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"text/template"
 )
@@ -13,12 +13,32 @@ import (
 type Marid interface {
 	Configuration
 	Logr
+	Blocker
 	Doer
+	Checker
+	Regenerator
+	Pruner
 	Templater
 }
 
+type Blocker interface {
+	GetBlock(string) (Block, error)
+	GetBlocks() map[string]Block
+	Info(string) (*BlockInfo, error)
+}
+
 type Doer interface {
 	Do(string, []string) error
+	DoWith(context.Context, string, Params, ...DoOption) (*Result, error)
+}
+
+type Checker interface {
+	Check(string, []string) error
+	CheckLock() error
+}
+
+type Regenerator interface {
+	Regen() error
 }
 
 type Templater interface {
@@ -44,206 +64,456 @@ func New(cnf ...Config) Marid {
 		FuncSet:   NewFuncSet(),
 	}
 	m.AddLoaders(baseLoader)
+	m.AddFuncs(baseFuncs)
 	m.Configuration = newConfiguration(m, cnf...)
 	return m
 }
 
-func (m *manager) render(t *template.Template, d interface{}, dir, file string) error {
+type output struct {
+	dir      string
+	file     string
+	path     string
+	src      []byte
+	baseline []byte
+	conflict bool
+	origins  []origin
+}
+
+func (m *manager) Info(tag string) (*BlockInfo, error) {
+	info, err := m.BlockSet.Info(tag, m.GetLoaders()...)
+	if err != nil {
+		return nil, err
+	}
+	blk, err := m.GetBlock(tag)
+	if err != nil {
+		return nil, err
+	}
+	fls, err := blk.Params().FlagSet(tag)
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool)
+	if m.derive(fls, set) != nil || validate(tag, fls, set) != nil {
+		return info, nil
+	}
+	td := NewTemplateData(blk, fls)
+	td.Data["PackageName"] = blk.Package()
+	td.Data["MaridVersion"] = m.version
+	for _, ti := range info.Templates {
+		if name, nErr := m.outputName(blk, ti.Name, td.Data); nErr == nil {
+			ti.Output = filepath.Join(blk.Directory(), name)
+		}
+	}
+	return info, nil
+}
+
+func (m *manager) outputName(blk Block, t string, data interface{}) (string, error) {
+	pattern := outputPattern(blk, t)
+	nt, err := template.New(t).Funcs(m.GetFuncs()).Parse(pattern)
+	if err != nil {
+		return "", OutputNameError(t, err)
+	}
+	b := m.get()
+	defer m.put(b)
+	if err := nt.Execute(b, data); err != nil {
+		return "", OutputNameError(t, err)
+	}
+	name := filepath.Clean(strings.TrimSpace(b.String()))
+	switch {
+	case filepath.IsAbs(name), name == "..", strings.HasPrefix(name, ".."+string(filepath.Separator)):
+		return "", OutputNameError(t, fmt.Sprintf("%s is outside the block directory", name))
+	case name == ".", strings.HasSuffix(name, string(filepath.Separator)):
+		return "", OutputNameError(t, "empty file name")
+	}
+	return name, nil
+}
+
+func (m *manager) render(t *template.Template, d interface{}, dir, file, name string, pp []PostProcessor) (*output, error) {
 	m.PrintIf("rendering template %s...", t.Name())
 	b := m.get()
+	defer m.put(b)
 
 	if xErr := t.Execute(b, d); xErr != nil {
-		return RenderError(xErr)
+		return nil, RenderError(xErr)
 	}
 
-	src, fErr := format.Source(b.Bytes())
+	rendered, origins := unmark(b.Bytes())
+	src, fErr := process(name, rendered, pp)
 	if fErr != nil {
-		m.PrintIf("go source format error: %s", fErr.Error())
-		m.PrintIf("for provided source:\n%s", b.Bytes())
-		return InvalidGoCodeError(fErr)
+		if gErr, ok := fErr.(*GoSourceError); ok {
+			gErr.locate(origins)
+		}
+		m.PrintIf("post processing error: %s", fErr.Error())
+		return nil, fErr
 	}
 
-	output := strings.ToLower(fmt.Sprintf("%s.go", file))
-	outputPath := filepath.Join(dir, output)
-	if wErr := ioutil.WriteFile(outputPath, src, 0644); wErr != nil {
-		return RenderError(wErr)
+	o := &output{dir: dir, file: file, path: filepath.Join(dir, name), src: src}
+	if m.merge {
+		o.baseline = src
 	}
 
-	m.put(b)
-	m.PrintIf("rendered to directory %s, file %s", dir, file)
-	return nil
+	if existing, err := m.existing(o.path); err == nil {
+		if src, err = m.preserve(o.path, src, existing); err != nil {
+			return nil, err
+		}
+		if src, fErr = process(name, src, pp); fErr != nil {
+			return nil, fErr
+		}
+		if m.merge {
+			if src, o.conflict, err = m.mergeBaseline(o.path, src, existing, pp); err != nil {
+				return nil, err
+			}
+		}
+		o.src = src
+	}
+	if m.typeCheck {
+		o.origins = retrace(rendered, o.src, origins)
+	}
+
+	return o, nil
 }
 
-func (m *manager) Do(bl string, fl []string) error {
-	m.PrintIf("Doing block %s with args %s", bl, fl)
-	if blk, err := m.GetBlock(bl); err == nil {
-		fls := blk.Flags()
-		fpErr := fls.Parse(fl)
-		if fpErr != nil {
-			return fpErr
-		}
-		td := NewTemplateData(blk, fls)
-		var rErr error
-		for _, t := range blk.Templates() {
-			tmpl, tfErr := m.Fetch(t)
-			if tfErr != nil {
-				return tfErr
-			}
-			rErr = m.render(tmpl, td.Data, blk.Directory(), t)
-			if rErr != nil {
-				return rErr
+func (m *manager) emit(tag string, outs ...*output) error {
+	switch {
+	case m.dryRun:
+		for _, o := range outs {
+			fmt.Fprintf(m.output, "// %s\n%s\n", o.path, o.src)
+			m.PrintIf("dry run for directory %s, file %s", o.dir, o.file)
+		}
+	case m.diff:
+		differ := false
+		for _, o := range outs {
+			d, err := m.diffOutput(o)
+			if err != nil {
+				return err
 			}
+			differ = differ || d
+		}
+		if differ {
+			return DiffError(tag)
+		}
+	default:
+		if gErr := m.guard(outs...); gErr != nil {
+			return gErr
+		}
+		if wErr := m.write(outs...); wErr != nil {
+			return RenderError(wErr)
+		}
+		for _, o := range outs {
+			m.PrintIf("rendered to directory %s, file %s", o.dir, o.file)
+		}
+		if c := conflicted(outs...); c != "" {
+			return MergeConflictError(c)
 		}
-		m.PrintIf("block %s finished", bl)
-		return nil
 	}
-	return NoBlockError(bl)
+	return nil
 }
 
-func (m *manager) Render(t, dir string, data interface{}) error {
-	m.PrintIf("Render called for: %s", t)
-	if tmpl, err := m.Fetch(t); err == nil {
-		return m.render(tmpl, data, t, dir)
+func (m *manager) existing(path string) ([]byte, error) {
+	if rs, ok := m.sink.(ReadableSink); ok {
+		return rs.Existing(path)
 	}
-	return NoTemplateError(t)
+	return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
 }
 
-func (m *manager) Fetch(t string) (*template.Template, error) {
-	m.PrintIf("Fetch called for %s", t)
-	return m.assemble(t)
+// guard refuses to overwrite files that marid did not generate: files with
+// neither a marker nor the content the lock records for them, which covers
+// outputs such as JSON that have no comment syntax for a marker.
+func (m *manager) guard(outs ...*output) error {
+	if m.force {
+		return nil
+	}
+	recorded := make(map[string]string)
+	if m.lockFile != "" {
+		l, err := m.readLock()
+		if err != nil {
+			return err
+		}
+		for _, e := range l.Entries {
+			for _, o := range e.Outputs {
+				recorded[filepath.Clean(o.Path)] = o.Hash
+			}
+		}
+	}
+	for _, o := range outs {
+		src, err := m.existing(o.path)
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case err != nil:
+			return RenderError(err)
+		case generated(src), recorded[filepath.Clean(o.path)] == hashBytes(src):
+			continue
+		default:
+			return OverwriteError(o.path)
+		}
+	}
+	return nil
 }
 
-type Node struct {
-	Name string
-	Src  string
-}
+func (m *manager) write(outs ...*output) error {
+	var files []OutputFile
+	rollback := func() {
+		for i := len(files) - 1; i >= 0; i-- {
+			if err := files[i].Discard(); err != nil {
+				m.Printf("rollback error: %s", err)
+			}
+		}
+	}
 
-var (
-	reExtendsTag  *regexp.Regexp = regexp.MustCompile("{{ extends [\"']?([^'\"}']*)[\"']? }}")
-	reIncludeTag  *regexp.Regexp = regexp.MustCompile(`{{ include ["']?([^"]*)["']? }}`)
-	reDefineTag   *regexp.Regexp = regexp.MustCompile("{{ ?define \"([^\"]*)\" ?\"?([a-zA-Z0-9]*)?\"? ?}}")
-	reTemplateTag *regexp.Regexp = regexp.MustCompile("{{ ?template \"([^\"]*)\" ?([^ ]*)? ?}}")
-)
+	stage := func(path string, src []byte) error {
+		f, err := m.sink.Open(path, m.fileMode)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		_, err = f.Write(src)
+		return err
+	}
 
-func (m *manager) assemble(t string) (*template.Template, error) {
-	m.PrintIf("assembling...%s", t)
-	stack := []*Node{}
+	for _, o := range outs {
+		if err := stage(o.path, o.src); err != nil {
+			rollback()
+			return err
+		}
+		if o.baseline != nil {
+			if err := stage(baselinePath(o.path), o.baseline); err != nil {
+				rollback()
+				return err
+			}
+		}
+	}
 
-	err := m.add(&stack, t)
+	for _, f := range files {
+		if err := f.Commit(); err != nil {
+			// uncommitted files are dropped, committed files restored
+			rollback()
+			return err
+		}
+	}
+	return nil
+}
 
+func (m *manager) diffOutput(o *output) (bool, error) {
+	existing, err := m.existing(o.path)
+	switch {
+	case os.IsNotExist(err):
+		fmt.Fprintf(m.output, "%s: would be created\n", o.path)
+		return true, nil
+	case err != nil:
+		return false, RenderError(err)
+	case bytes.Equal(existing, o.src):
+		fmt.Fprintf(m.output, "%s: unchanged\n", o.path)
+		return false, nil
+	}
+	m.output.Write(unifiedDiff("a/"+o.path, "b/"+o.path, existing, o.src))
+	return true, nil
+}
+
+func (m *manager) build(r *request) ([]*output, *LockEntry, error) {
+	blk, err := m.GetBlock(r.block)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	fls, fsErr := blk.Params().FlagSet(r.block)
+	if fsErr != nil {
+		return nil, nil, fsErr
+	}
+	set, aErr := r.apply(fls)
+	if aErr != nil {
+		return nil, nil, aErr
+	}
+	if dErr := m.derive(fls, set); dErr != nil {
+		return nil, nil, dErr
+	}
+	if vErr := validate(r.block, fls, set); vErr != nil {
+		return nil, nil, vErr
 	}
 
-	blocks := map[string]string{}
-	blockId := 0
+	dir, pkg := blk.Directory(), r.pkg
+	if r.dir != "" {
+		dir = r.dir
+	}
+	if pkg == "" {
+		pkg = detectPackage(dir)
+	}
+	if pkg == "" {
+		pkg = blk.Package()
+	}
 
-	for _, node := range stack {
-		var errInReplace error = nil
-		node.Src = reIncludeTag.ReplaceAllStringFunc(node.Src, func(raw string) string {
-			parsed := reIncludeTag.FindStringSubmatch(raw)
-			templatePath := parsed[1]
-			subTpl, err := getTemplate(m, templatePath)
-			if err != nil {
-				errInReplace = err
-				return "[error]"
+	td := NewTemplateData(blk, fls)
+	td.Data["PackageName"] = pkg
+	td.Data["MaridVersion"] = m.version
+	entry := newLockEntry(r.block, dir, pkg, fls, set, m.version)
+	var outs []*output
+	produced := make(map[string]string)
+	for _, t := range blk.Templates() {
+		if cErr := r.ctx.Err(); cErr != nil {
+			return nil, nil, cErr
+		}
+		tmpl, tfErr := m.assemble(t, true)
+		if tfErr != nil {
+			return nil, nil, tfErr
+		}
+		hash, hErr := m.templateHash(t)
+		if hErr != nil {
+			return nil, nil, hErr
+		}
+		entry.Templates = append(entry.Templates, &LockTemplate{t, hash})
+		name, nErr := m.outputName(blk, t, td.Data)
+		if nErr != nil {
+			return nil, nil, nErr
+		}
+		if prev, ok := produced[name]; ok {
+			return nil, nil, OutputNameError(t, fmt.Sprintf("%s is also produced by template %s", name, prev))
+		}
+		produced[name] = t
+		data := td.Data
+		if p := packageFor(dir, name, pkg); p != pkg {
+			data = make(map[string]interface{}, len(td.Data))
+			for k, v := range td.Data {
+				data[k] = v
 			}
-			return subTpl
-		})
-		if errInReplace != nil {
-			return nil, errInReplace
+			data["PackageName"] = p
+		}
+		o, rErr := m.render(tmpl, data, dir, t, name, processors(blk, t, name))
+		if rErr != nil {
+			return nil, nil, rErr
 		}
+		entry.Outputs = append(entry.Outputs, &LockOutput{o.path, hashBytes(o.src)})
+		outs = append(outs, o)
 	}
-
-	for _, node := range stack {
-		node.Src = reDefineTag.ReplaceAllStringFunc(node.Src, func(raw string) string {
-			parsed := reDefineTag.FindStringSubmatch(raw)
-			blockName := fmt.Sprintf("BLOCK_%d", blockId)
-			blocks[parsed[1]] = blockName
-
-			blockId += 1
-			return "{{ define \"" + blockName + "\" }}"
-		})
+	if m.typeCheck {
+		if tErr := m.verify(outs); tErr != nil {
+			return nil, nil, tErr
+		}
 	}
+	return outs, entry, nil
+}
 
-	var rootTemplate *template.Template
+func (m *manager) do(r *request) (*Result, error) {
+	outs, entry, err := m.build(r)
+	if err != nil {
+		return nil, err
+	}
+	orphaned, oErr := m.orphans(entry)
+	if oErr != nil {
+		return nil, oErr
+	}
+	if cErr := r.ctx.Err(); cErr != nil {
+		return nil, cErr
+	}
+	if eErr := m.emit(r.block, outs...); eErr != nil {
+		return nil, eErr
+	}
 
-	for i, node := range stack {
-		node.Src = reTemplateTag.ReplaceAllStringFunc(node.Src, func(raw string) string {
-			parsed := reTemplateTag.FindStringSubmatch(raw)
-			origName := parsed[1]
-			replacedName, ok := blocks[origName]
+	res := &Result{Block: r.block, Directory: entry.Directory, Package: entry.Package}
+	for _, o := range outs {
+		res.Files = append(res.Files, &GeneratedFile{o.file, o.path, o.src})
+	}
 
-			dot := "."
-			if len(parsed) == 3 && len(parsed[2]) > 0 {
-				dot = parsed[2]
+	if !m.dryRun && !m.diff {
+		switch {
+		case len(orphaned) == 0:
+		case m.prune:
+			if pErr := m.remove(orphaned...); pErr != nil {
+				return nil, pErr
 			}
-			if ok {
-				return fmt.Sprintf(`{{ template "%s" %s }}`, replacedName, dot)
-			} else {
-				return ""
+			res.Pruned = orphaned
+		default:
+			for _, o := range orphaned {
+				m.Printf("warning: %s was generated by block %s but is no longer produced, use prune to remove it", o, r.block)
 			}
-		})
-
-		var thisTemplate *template.Template
-
-		if i == 0 {
-			thisTemplate = template.New(node.Name)
-			rootTemplate = thisTemplate
-		} else {
-			thisTemplate = rootTemplate.New(node.Name)
 		}
-
-		thisTemplate.Funcs(m.GetFuncs())
-
-		_, err := thisTemplate.Parse(node.Src)
-		if err != nil {
-			return nil, err
+		if lErr := m.lock(entry); lErr != nil {
+			return nil, lErr
 		}
 	}
+	m.PrintIf("block %s finished", r.block)
+	return res, nil
+}
 
-	m.PrintIf("assembled")
-	return rootTemplate, nil
+func (m *manager) Do(bl string, fl []string) error {
+	m.PrintIf("Doing block %s with args %s", bl, fl)
+	_, err := m.do(newRequest(nil, bl, fl, nil))
+	return err
+}
+
+func (m *manager) Check(bl string, fl []string) error {
+	m.PrintIf("Checking block %s with args %s", bl, fl)
+	return m.check(newRequest(nil, bl, fl, nil))
 }
 
-func getTemplate(m *manager, t string) (string, error) {
-	for _, l := range m.GetLoaders() {
-		tmpl, err := l.Load(t)
-		if err == nil {
-			return tmpl, nil
+func (m *manager) check(r *request) error {
+	outs, _, err := m.build(r)
+	if err != nil {
+		return err
+	}
+	stale := &StaleError{Block: r.block}
+	for _, o := range outs {
+		existing, rErr := m.existing(o.path)
+		switch {
+		case os.IsNotExist(rErr):
+			stale.Missing = append(stale.Missing, o.path)
+		case rErr != nil:
+			return RenderError(rErr)
+		case !bytes.Equal(existing, o.src):
+			stale.Stale = append(stale.Stale, o.path)
 		}
 	}
-	return "", NoTemplateError(t)
+	if len(stale.Stale) > 0 || len(stale.Missing) > 0 {
+		return stale
+	}
+	m.PrintIf("block %s up to date", r.block)
+	return nil
 }
 
-func (m *manager) add(stack *[]*Node, t string) error {
-	m.PrintIf("adding node %s...", t)
-	tplSrc, err := getTemplate(m, t)
-
+func (m *manager) CheckLock() error {
+	m.PrintIf("Checking blocks in %s", m.lockFile)
+	if m.lockFile == "" {
+		return LockError("(none)", "lock file disabled")
+	}
+	l, err := m.readLock()
 	if err != nil {
 		return err
 	}
-
-	if len(tplSrc) < 1 {
-		return EmptyTemplateError(t)
+	if len(l.Entries) == 0 {
+		return LockError(m.lockFile, "no entries to check")
 	}
-
-	extendsMatches := reExtendsTag.FindStringSubmatch(tplSrc)
-	if len(extendsMatches) == 2 {
-		err := m.add(stack, extendsMatches[1])
-		if err != nil {
-			return err
+	all := &StaleError{}
+	var tags []string
+	for _, e := range l.Entries {
+		tags = append(tags, e.Block)
+		cErr := m.check(newRequest(nil, e.Block, e.Args(), nil, InDirectory(e.Directory), InPackage(e.Package)))
+		if stale, ok := cErr.(*StaleError); ok {
+			all.Stale = append(all.Stale, stale.Stale...)
+			all.Missing = append(all.Missing, stale.Missing...)
+		} else if cErr != nil {
+			return cErr
 		}
-		tplSrc = reExtendsTag.ReplaceAllString(tplSrc, "")
 	}
-
-	node := &Node{
-		Name: t,
-		Src:  tplSrc,
+	if len(all.Stale) > 0 || len(all.Missing) > 0 {
+		all.Block = strings.Join(tags, ", ")
+		return all
 	}
+	return nil
+}
 
-	*stack = append((*stack), node)
+func (m *manager) Render(t, dir string, data interface{}) error {
+	m.PrintIf("Render called for: %s", t)
+	tmpl, err := m.assemble(t, true)
+	if err != nil {
+		return err
+	}
+	name := outputName(t)
+	o, rErr := m.render(tmpl, data, dir, t, name, defaultProcessors(name))
+	if rErr != nil {
+		return rErr
+	}
+	return m.emit(t, o)
+}
 
-	m.PrintIf("added node")
-	return nil
+func (m *manager) Fetch(t string) (*template.Template, error) {
+	m.PrintIf("Fetch called for %s", t)
+	return m.assemble(t, false)
 }
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/thrisp/marid"
 	"github.com/thrisp/marid/blocks/configuration"
@@ -10,9 +13,6 @@ import (
 )
 
 var (
-	blockArg      string
-	blockArgs     []string
-	version       bool
 	verbose       bool
 	defaultBlocks []marid.Block = []marid.Block{
 		xrror.Block,
@@ -20,69 +20,231 @@ var (
 	}
 )
 
-func index(s []string) map[int]string {
-	indexd := make(map[int]string)
-	for i, in := range s {
-		indexd[i] = in
+type command struct {
+	name  string
+	args  string
+	short string
+	run   func([]string) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"list", "", "list available blocks", list},
+		{"describe", "<block>", "describe a block's flags, templates, directory and package", describe},
+		{"gen", "[options] <block> [block flags]", "generate a block", gen},
+		{"check", "[<block> [block flags]]", "fail if generated files are stale, checking marid.lock without a block", check},
+		{"regen", "[options]", "regenerate every block recorded in marid.lock", regen},
+		{"version", "", "print the marid version", version},
+	}
+}
+
+type usageError string
+
+func (u usageError) Error() string {
+	return string(u)
+}
+
+func usage() {
+	w := os.Stderr
+	fmt.Fprintf(w, "usage: marid [-verbose] <command> [arguments]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s\n    \t%s\n", strings.TrimSpace(c.name+" "+c.args), c.short)
+	}
+	fmt.Fprintf(w, "\noptions:\n")
+	flag.PrintDefaults()
+}
+
+func newMarid(cnf ...marid.Config) marid.Marid {
+	cnf = append([]marid.Config{
+		marid.Version(versionTag),
+		marid.Verbose(verbose),
+		marid.Blocks(defaultBlocks...),
+	}, cnf...)
+	m := marid.New(cnf...)
+	if err := m.Configure(); err != nil {
+		m.Fatalf("configuration error: %s", err)
+	}
+	return m
+}
+
+func commandFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		for _, c := range commands {
+			if c.name == name {
+				fmt.Fprintf(os.Stderr, "usage: marid %s %s\n", c.name, c.args)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func outputFlags(fs *flag.FlagSet) func() []marid.Config {
+	dryRun := fs.Bool("dry-run", false, "print rendered files instead of writing them")
+	diff := fs.Bool("diff", false, "print a diff against files on disk instead of writing them")
+	force := fs.Bool("force", false, "overwrite files not generated by marid")
+	merge := fs.Bool("merge", false, "three-way merge with edits to generated files")
+	prune := fs.Bool("prune", false, "remove files the block no longer produces")
+	typeCheck := fs.Bool("typecheck", false, "type check generated Go with its package before writing")
+	return func() []marid.Config {
+		cnf := []marid.Config{
+			marid.Force(*force),
+			marid.Merge(*merge),
+			marid.Prune(*prune),
+			marid.TypeCheck(*typeCheck),
+		}
+		if *dryRun {
+			cnf = append(cnf, marid.DryRun(os.Stdout))
+		}
+		if *diff {
+			cnf = append(cnf, marid.Diff(os.Stdout))
+		}
+		return cnf
 	}
-	return indexd
 }
 
-func cull(s []string, id map[int]string) map[int]string {
-	var toDelete []int
-	add := func(d int) { toDelete = append(toDelete, d) }
-	for i, label := range s {
-		switch label {
-		case "-block", "-b":
-			add(i)
-			blockArg = id[i+1]
-			add(i + 1)
-		case "-version", "-v":
-			add(i)
-			fmt.Println(fmtVersion())
-			os.Exit(0)
-		case "-verbose", "-vv":
-			add(i)
-			verbose = true
+func list(args []string) error {
+	if len(args) > 0 {
+		return usageError("list takes no arguments")
+	}
+	m := newMarid()
+	var tags []string
+	for tag := range m.GetBlocks() {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	fmt.Println(strings.Join(tags, "\n"))
+	return nil
+}
+
+func describe(args []string) error {
+	if len(args) != 1 {
+		return usageError("describe takes exactly one block")
+	}
+	m := newMarid()
+	info, err := m.Info(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("block:     %s\n", info.Tag)
+	if info.Description != "" {
+		fmt.Printf("           %s\n", info.Description)
+	}
+	fmt.Printf("directory: %s\n", info.Directory)
+	fmt.Printf("package:   %s\n", info.Package)
+	fmt.Printf("templates:\n")
+	for _, t := range info.Templates {
+		output := t.Output
+		if output == "" {
+			output = t.Pattern
 		}
+		fmt.Printf("  %s -> %s (%s)\n", t.Name, output, t.LoaderType)
 	}
-	for _, d := range toDelete {
-		delete(id, d)
+	fmt.Printf("flags:\n")
+	fmt.Printf("  -dir string (default %q) output directory\n", info.Directory)
+	fmt.Printf("  -package string (detected from -dir, else %q) package name\n", info.Package)
+	for _, p := range info.Params {
+		switch {
+		case p.Required:
+			fmt.Printf("  -%s %s (required)", p.Name, p.Type)
+		case p.Derived != "":
+			fmt.Printf("  -%s %s (derived %s)", p.Name, p.Type, p.Derived)
+		default:
+			fmt.Printf("  -%s %s (default %q)", p.Name, p.Type, p.Default)
+		}
+		if p.Usage != "" {
+			fmt.Printf(" %s", p.Usage)
+		}
+		fmt.Println()
 	}
-	return id
+	return nil
 }
 
-func list(si map[int]string) []string {
-	var ret []string
-	for _, v := range si {
-		ret = append(ret, v)
+func gen(args []string) error {
+	fs := commandFlags("gen")
+	cnf := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() < 1 {
+		return usageError("gen requires a block")
 	}
-	return ret
+	m := newMarid(cnf()...)
+	if err := m.Do(fs.Arg(0), fs.Args()[1:]); err != nil {
+		return err
+	}
+	m.PrintIf("done.")
+	return nil
 }
 
-func parse(s []string) {
-	blockArgs = list(cull(s, index(s)))
+func check(args []string) error {
+	m := newMarid()
+	if len(args) == 0 {
+		return m.CheckLock()
+	}
+	if err := m.Check(args[0], args[1:]); err != nil {
+		return err
+	}
+	m.PrintIf("up to date.")
+	return nil
 }
 
-func init() {
-	parse(os.Args[1:])
+func regen(args []string) error {
+	fs := commandFlags("regen")
+	cnf := outputFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() > 0 {
+		return usageError("regen takes no arguments")
+	}
+	m := newMarid(cnf()...)
+	if err := m.Regen(); err != nil {
+		return err
+	}
+	m.PrintIf("done.")
+	return nil
 }
 
-func main() {
-	if verbose {
-		marid.DefaultLogr.PrintIf("starting...")
+func version(args []string) error {
+	if len(args) > 0 {
+		return usageError("version takes no arguments")
 	}
-	m := marid.New(marid.Verbose(verbose), marid.Blocks(defaultBlocks...))
-	if err := m.Configure(); err != nil {
-		m.Fatalf("configuration error: %s", err)
+	fmt.Println(fmtVersion())
+	return nil
+}
+
+func main() {
+	flag.BoolVar(&verbose, "verbose", false, "verbose logging")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
 	}
 
-	if blockArg != "" {
-		if err := m.Do(blockArg, blockArgs); err != nil {
-			m.Fatalf("do error: %s", err)
+	name, args := flag.Arg(0), flag.Args()[1:]
+	for _, c := range commands {
+		if c.name == name {
+			err := c.run(args)
+			switch err.(type) {
+			case nil:
+				os.Exit(0)
+			case usageError:
+				fmt.Fprintf(os.Stderr, "marid %s: %s\n", name, err)
+				os.Exit(2)
+			default:
+				fmt.Fprintf(os.Stderr, "marid %s: %s\n", name, err)
+				os.Exit(1)
+			}
 		}
-		m.PrintIf("done.")
-		os.Exit(0)
 	}
-	m.Fatalf("no block specified! exiting.")
+
+	fmt.Fprintf(os.Stderr, "marid: unknown command %q\n", name)
+	usage()
+	os.Exit(2)
 }
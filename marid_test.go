@@ -0,0 +1,36 @@
+package marid
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGuardRecordedOutputs(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	l := MapLoader(map[string]string{"data": `{"name": "{{ .Name }}"}
+`})
+	ps := ParamSet{StringParam("Name", "", "").Require()}
+	blk := BasicBlock("data", ps, l, []string{"data"}, OutputNames(map[string]string{"data": "data.json"}))
+	m := New(Blocks(blk), LockFile(filepath.Join(dir, "marid.lock"))).(*manager)
+	m.Configure()
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := m.DoWith(context.Background(), "data", Params{"Name": name}, InDirectory(dir)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(dir, "data.json")
+	if err := ioutil.WriteFile(path, []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := m.DoWith(context.Background(), "data", Params{"Name": "c"}, InDirectory(dir))
+	if err == nil || !strings.Contains(err.Error(), "refusing to overwrite") {
+		t.Errorf("expected the edited file to be refused, got %v", err)
+	}
+}
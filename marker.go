@@ -0,0 +1,20 @@
+package marid
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	reGeneratedMarker *regexp.Regexp = regexp.MustCompile(`(?m)^(?://|#|--|<!--) Code generated by marid .* DO NOT EDIT\.(?: -->)?$`)
+	reLegacyMarker    *regexp.Regexp = regexp.MustCompile(`(?m)^// block \S+ created by Marid$`)
+)
+
+func generated(src []byte) bool {
+	return reGeneratedMarker.Match(src) || reLegacyMarker.Match(src)
+}
+
+func generatedBy(src []byte, tag string) bool {
+	re := regexp.MustCompile(fmt.Sprintf(`(?m)^(?://|#|--|<!--) Code generated by marid .* from block %s(?: with flags .*)?\. DO NOT EDIT\.(?: -->)?$`, regexp.QuoteMeta(tag)))
+	return re.Match(src)
+}
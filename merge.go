@@ -0,0 +1,133 @@
+package marid
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const stateDirectory = ".marid"
+
+func baselinePath(path string) string {
+	return filepath.Join(filepath.Dir(path), stateDirectory, filepath.Base(path))
+}
+
+func matchLines(base, other []string) []int {
+	ret := make([]int, len(base))
+	for i := range ret {
+		ret[i] = -1
+	}
+	for _, l := range diffLines(base, other) {
+		if l.kind == ' ' {
+			ret[l.a] = l.b
+		}
+	}
+	return ret
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeLines(b *bytes.Buffer, lines []string) {
+	for _, l := range lines {
+		b.WriteString(l)
+		b.WriteByte('\n')
+	}
+}
+
+// merge3 merges the changes from base to ours and from base to theirs,
+// returning false when conflict markers had to be written.
+func merge3(base, ours, theirs []byte) ([]byte, bool) {
+	o, a, t := splitLines(base), splitLines(ours), splitLines(theirs)
+	ma, mt := matchLines(o, a), matchLines(o, t)
+
+	var b bytes.Buffer
+	clean := true
+	i, j, k := 0, 0, 0
+	for i < len(o) || j < len(a) || k < len(t) {
+		n := 0
+		for i+n < len(o) && ma[i+n] == j+n && mt[i+n] == k+n {
+			n++
+		}
+		if n > 0 {
+			writeLines(&b, o[i:i+n])
+			i, j, k = i+n, j+n, k+n
+			continue
+		}
+
+		next, nj, nk := len(o), len(a), len(t)
+		for s := i; s < len(o); s++ {
+			if ma[s] >= 0 && mt[s] >= 0 {
+				next, nj, nk = s, ma[s], mt[s]
+				break
+			}
+		}
+
+		oc, ac, tc := o[i:next], a[j:nj], t[k:nk]
+		switch {
+		case equalLines(oc, ac):
+			writeLines(&b, tc)
+		case equalLines(oc, tc), equalLines(ac, tc):
+			writeLines(&b, ac)
+		default:
+			clean = false
+			b.WriteString("<<<<<<< current\n")
+			writeLines(&b, ac)
+			b.WriteString("||||||| baseline\n")
+			writeLines(&b, oc)
+			b.WriteString("=======\n")
+			writeLines(&b, tc)
+			b.WriteString(">>>>>>> generated\n")
+		}
+		i, j, k = next, nj, nk
+	}
+	return b.Bytes(), clean
+}
+
+func (m *manager) mergeBaseline(path string, src, existing []byte, pp []PostProcessor) ([]byte, bool, error) {
+	base, err := m.existing(baselinePath(path))
+	switch {
+	case os.IsNotExist(err):
+		return src, false, nil
+	case err != nil:
+		return nil, false, RenderError(err)
+	}
+
+	// formatting the current file the same way as the generated one keeps
+	// formatting differences from conflicting
+	if formatted, fErr := process(path, existing, pp); fErr == nil {
+		existing = formatted
+	}
+
+	merged, clean := merge3(base, existing, src)
+	if !clean {
+		m.Printf("warning: %s: merge conflicts written, resolve the conflict markers", path)
+		return merged, true, nil
+	}
+
+	processed, pErr := process(path, merged, pp)
+	if pErr != nil {
+		return nil, false, pErr
+	}
+	return processed, false, nil
+}
+
+func conflicted(outs ...*output) string {
+	var paths []string
+	for _, o := range outs {
+		if o.conflict {
+			paths = append(paths, o.path)
+		}
+	}
+	return strings.Join(paths, ", ")
+}
@@ -0,0 +1,65 @@
+package marid
+
+import (
+	"strings"
+	"testing"
+)
+
+func lines(l ...string) []byte {
+	return []byte(strings.Join(l, "\n") + "\n")
+}
+
+func TestMerge3(t *testing.T) {
+	base := lines("a", "b", "c", "d")
+	cases := []struct {
+		name          string
+		ours, theirs  []byte
+		expect        []byte
+		expectedClean bool
+	}{
+		{"unchanged", base, base, base, true},
+		{"ours only", lines("a", "B", "c", "d"), base, lines("a", "B", "c", "d"), true},
+		{"theirs only", base, lines("a", "b", "c", "D"), lines("a", "b", "c", "D"), true},
+		{"both apart", lines("A", "b", "c", "d"), lines("a", "b", "c", "D"), lines("A", "b", "c", "D"), true},
+		{"same change", lines("a", "X", "c", "d"), lines("a", "X", "c", "d"), lines("a", "X", "c", "d"), true},
+		{"ours adds", lines("a", "b", "new", "c", "d"), lines("a", "b", "c", "D"), lines("a", "b", "new", "c", "D"), true},
+		{
+			"conflict",
+			lines("a", "ours", "c", "d"),
+			lines("a", "theirs", "c", "d"),
+			lines("a", "<<<<<<< current", "ours", "||||||| baseline", "b", "=======", "theirs", ">>>>>>> generated", "c", "d"),
+			false,
+		},
+	}
+	for _, c := range cases {
+		merged, clean := merge3(base, c.ours, c.theirs)
+		if clean != c.expectedClean {
+			t.Errorf("%s: clean was %t, expected %t", c.name, clean, c.expectedClean)
+		}
+		if string(merged) != string(c.expect) {
+			t.Errorf("%s: merged\n%s\nexpected\n%s", c.name, merged, c.expect)
+		}
+	}
+}
+
+func TestMergeBaselineIgnoresFormatting(t *testing.T) {
+	sink := NewMemorySink()
+	m := New(Sink(sink), LockFile("")).(*manager)
+	m.Configure()
+
+	base := []byte("package p\n\nfunc X() {}\n")
+	src := []byte("package p\n\nfunc X() { println() }\n")
+	existing := []byte("package p\n\nfunc X()   {  }\n")
+	sink.Files[baselinePath("p.go")] = base
+
+	merged, conflict, err := m.mergeBaseline("p.go", src, existing, []PostProcessor{Gofmt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conflict {
+		t.Fatalf("formatting difference conflicted:\n%s", merged)
+	}
+	if string(merged) != string(src) {
+		t.Errorf("merged\n%s\nexpected\n%s", merged, src)
+	}
+}
@@ -0,0 +1,61 @@
+package marid
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// detectPackage returns the package name used by the go files already in
+// dir, or an empty string when there are none.
+func detectPackage(dir string) string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	counts := make(map[string]int)
+	fset := token.NewFileSet()
+	for _, fi := range infos {
+		name := fi.Name()
+		if fi.IsDir() || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, pErr := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.PackageClauseOnly)
+		if pErr != nil {
+			continue
+		}
+		counts[f.Name.Name]++
+	}
+	var names []string
+	for n := range counts {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	ret := ""
+	for _, n := range names {
+		if counts[n] > counts[ret] {
+			ret = n
+		}
+	}
+	return ret
+}
+
+// packageFor returns the package name for an output written to name within
+// dir. Outputs in a subdirectory belong to the package detected there, or
+// one named after the subdirectory, rather than to pkg.
+func packageFor(dir, name, pkg string) string {
+	sub := filepath.Dir(name)
+	if sub == "." {
+		return pkg
+	}
+	if p := detectPackage(filepath.Join(dir, sub)); p != "" {
+		return p
+	}
+	if base := filepath.Base(sub); isIdentifier(base) {
+		return base
+	}
+	return pkg
+}
@@ -0,0 +1,231 @@
+package marid
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ParamKind int
+
+const (
+	StringKind ParamKind = iota
+	BoolKind
+	IntKind
+	DurationKind
+	ListKind
+	MapKind
+	EnumKind
+)
+
+var paramKinds = []string{"string", "bool", "int", "duration", "list", "map", "enum"}
+
+func (k ParamKind) String() string {
+	if int(k) < len(paramKinds) {
+		return paramKinds[k]
+	}
+	return "unknown"
+}
+
+type Param struct {
+	Name     string
+	Kind     ParamKind
+	Default  interface{}
+	Usage    string
+	Choices  []string
+	Required bool
+	Rules    []Rule
+	Derive   string
+}
+
+func StringParam(name, def, usage string) *Param {
+	return &Param{Name: name, Kind: StringKind, Default: def, Usage: usage}
+}
+
+func BoolParam(name string, def bool, usage string) *Param {
+	return &Param{Name: name, Kind: BoolKind, Default: def, Usage: usage}
+}
+
+func IntParam(name string, def int, usage string) *Param {
+	return &Param{Name: name, Kind: IntKind, Default: def, Usage: usage}
+}
+
+func DurationParam(name string, def time.Duration, usage string) *Param {
+	return &Param{Name: name, Kind: DurationKind, Default: def, Usage: usage}
+}
+
+// ListParam values are set with comma separated items, repeating the flag
+// appends to the list.
+func ListParam(name string, def []string, usage string) *Param {
+	return &Param{Name: name, Kind: ListKind, Default: def, Usage: usage}
+}
+
+// MapParam values are set with comma separated key=value pairs, repeating
+// the flag adds to the map.
+func MapParam(name string, def map[string]string, usage string) *Param {
+	return &Param{Name: name, Kind: MapKind, Default: def, Usage: usage}
+}
+
+func EnumParam(name, def, usage string, choices ...string) *Param {
+	return &Param{Name: name, Kind: EnumKind, Default: def, Usage: usage, Choices: choices}
+}
+
+func (p *Param) Require() *Param {
+	p.Required = true
+	return p
+}
+
+func (p *Param) Validate(rules ...Rule) *Param {
+	p.Rules = append(p.Rules, rules...)
+	return p
+}
+
+// DeriveFrom sets a template expression, evaluated against the other param
+// values after parsing, that computes the param when it is not given.
+func (p *Param) DeriveFrom(expr string) *Param {
+	p.Derive = expr
+	return p
+}
+
+func (p *Param) value() *paramValue {
+	v := &paramValue{param: p}
+	switch p.Kind {
+	case ListKind:
+		var l []string
+		if d, ok := p.Default.([]string); ok {
+			l = append(l, d...)
+		}
+		v.value = l
+	case MapKind:
+		mp := make(map[string]string)
+		if d, ok := p.Default.(map[string]string); ok {
+			for k, dv := range d {
+				mp[k] = dv
+			}
+		}
+		v.value = mp
+	default:
+		v.value = p.Default
+	}
+	return v
+}
+
+type ParamSet []*Param
+
+// FlagSet returns a new flag set holding fresh values for every param, so
+// that each parse starts from the declared defaults.
+func (ps ParamSet) FlagSet(name string) (*flag.FlagSet, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	for _, p := range ps {
+		if fs.Lookup(p.Name) != nil {
+			return nil, ParamError(name, fmt.Sprintf("param %s declared more than once", p.Name))
+		}
+		fs.Var(p.value(), p.Name, p.Usage)
+	}
+	return fs, nil
+}
+
+type paramValue struct {
+	param    *Param
+	value    interface{}
+	replaced bool
+}
+
+func (v *paramValue) Get() interface{} {
+	return v.value
+}
+
+func (v *paramValue) IsBoolFlag() bool {
+	return v.param != nil && v.param.Kind == BoolKind
+}
+
+func (v *paramValue) String() string {
+	if v.param == nil || v.value == nil {
+		return ""
+	}
+	switch val := v.value.(type) {
+	case []string:
+		return strings.Join(val, ",")
+	case map[string]string:
+		var pairs []string
+		for k, mv := range val {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", k, mv))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	}
+	return fmt.Sprint(v.value)
+}
+
+func (v *paramValue) Set(s string) error {
+	switch v.param.Kind {
+	case StringKind:
+		v.value = s
+	case BoolKind:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.value = b
+	case IntKind:
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.value = i
+	case DurationKind:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.value = d
+	case ListKind:
+		var l []string
+		if v.replaced {
+			l = v.value.([]string)
+		}
+		for _, item := range strings.Split(s, ",") {
+			if item != "" {
+				l = append(l, item)
+			}
+		}
+		v.value = l
+	case MapKind:
+		mp := make(map[string]string)
+		if v.replaced {
+			mp = v.value.(map[string]string)
+		}
+		for _, pair := range strings.Split(s, ",") {
+			if pair == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("%q is not a key=value pair", pair)
+			}
+			mp[kv[0]] = kv[1]
+		}
+		v.value = mp
+	case EnumKind:
+		if !contains(v.param.Choices, s) {
+			return fmt.Errorf("%q is not one of %s", s, strings.Join(v.param.Choices, ", "))
+		}
+		v.value = s
+	}
+	v.replaced = true
+	return nil
+}
+
+func contains(l []string, s string) bool {
+	for _, item := range l {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
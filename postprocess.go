@@ -0,0 +1,58 @@
+package marid
+
+import (
+	"go/format"
+	"path/filepath"
+)
+
+type PostProcessor func(string, []byte) ([]byte, error)
+
+type PostProcessed interface {
+	PostProcessors(string) []PostProcessor
+}
+
+var (
+	None PostProcessor = func(_ string, src []byte) ([]byte, error) {
+		return src, nil
+	}
+
+	Gofmt PostProcessor = func(name string, src []byte) ([]byte, error) {
+		out, err := format.Source(src)
+		if err != nil {
+			return nil, goSourceError(name, src, err)
+		}
+		return out, nil
+	}
+
+	FixImports PostProcessor = ManageImports()
+)
+
+func defaultProcessors(name string, known ...string) []PostProcessor {
+	if filepath.Ext(name) == ".go" {
+		return []PostProcessor{ManageImports(known...)}
+	}
+	return []PostProcessor{None}
+}
+
+func processors(b Block, t, name string) []PostProcessor {
+	if p, ok := b.(PostProcessed); ok {
+		if pp := p.PostProcessors(t); len(pp) > 0 {
+			return pp
+		}
+	}
+	var known []string
+	if i, ok := b.(ImportDeclarer); ok {
+		known = i.Imports()
+	}
+	return defaultProcessors(name, known...)
+}
+
+func process(name string, src []byte, pp []PostProcessor) ([]byte, error) {
+	var err error
+	for _, p := range pp {
+		if src, err = p(name, src); err != nil {
+			return nil, err
+		}
+	}
+	return src, nil
+}
@@ -0,0 +1,300 @@
+package marid
+
+import (
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// A template may extend another with {{ extends "name" }}, replacing any of
+// the templates the other defines, and splice in the contents of others with
+// {{ include "name" }}. Both are resolved on parsed template trees, so any
+// action syntax, trim markers included, can be used for them.
+
+type Node struct {
+	Name string
+	Src  string
+}
+
+// builtins are the functions text/template provides, which its parser
+// expects to be given alongside any others.
+var builtins = []string{
+	"and", "call", "eq", "ge", "gt", "html", "index", "js", "le", "len",
+	"lt", "ne", "not", "or", "print", "printf", "println", "slice", "urlquery",
+}
+
+type source struct {
+	name      string
+	trees     map[string]*parse.Tree
+	extends   string
+	extendsAt string
+}
+
+type assembly struct {
+	m         *manager
+	marked    bool
+	funcs     map[string]interface{}
+	nodes     []*Node
+	including []string
+}
+
+func (m *manager) newAssembly(marked bool) *assembly {
+	funcs := map[string]interface{}{"extends": true, "include": true}
+	for _, b := range builtins {
+		funcs[b] = true
+	}
+	for k, v := range m.GetFuncs() {
+		funcs[k] = v
+	}
+	return &assembly{m: m, marked: marked, funcs: funcs}
+}
+
+func getTemplate(m *manager, t string) (string, error) {
+	for _, l := range m.GetLoaders() {
+		tmpl, err := l.Load(t)
+		if err == nil {
+			return tmpl, nil
+		}
+	}
+	return "", NoTemplateError(t)
+}
+
+func sortedTrees(trees map[string]*parse.Tree) []string {
+	var names []string
+	for name := range trees {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func walk(n parse.Node, fn func(parse.Node)) {
+	fn(n)
+	switch n := n.(type) {
+	case *parse.ListNode:
+		for _, c := range n.Nodes {
+			walk(c, fn)
+		}
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, fn)
+	}
+}
+
+func walkBranch(b *parse.BranchNode, fn func(parse.Node)) {
+	walk(b.List, fn)
+	if b.ElseList != nil {
+		walk(b.ElseList, fn)
+	}
+}
+
+// directive reports whether an action is an extends or include directive,
+// and the template it names.
+func directive(tree *parse.Tree, a *parse.ActionNode) (string, string, error) {
+	if len(a.Pipe.Cmds) != 1 {
+		return "", "", nil
+	}
+	args := a.Pipe.Cmds[0].Args
+	id, ok := args[0].(*parse.IdentifierNode)
+	if !ok || (id.Ident != "extends" && id.Ident != "include") {
+		return "", "", nil
+	}
+	loc, _ := tree.ErrorContext(a)
+	if len(a.Pipe.Decl) > 0 || len(args) != 2 {
+		return "", "", DirectiveError(loc, id.Ident+" takes a single quoted template name")
+	}
+	name, ok := args[1].(*parse.StringNode)
+	if !ok {
+		return "", "", DirectiveError(loc, id.Ident+" takes a single quoted template name")
+	}
+	return id.Ident, name.Text, nil
+}
+
+func (a *assembly) load(name string) (*source, error) {
+	for _, n := range a.including {
+		if n == name {
+			return nil, DirectiveError(name, "include cycle "+strings.Join(append(a.including, name), " -> "))
+		}
+	}
+	a.m.PrintIf("adding node %s...", name)
+	src, err := getTemplate(a.m, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(src) < 1 {
+		return nil, EmptyTemplateError(name)
+	}
+	a.nodes = append(a.nodes, &Node{Name: name, Src: src})
+
+	s := &source{name: name, trees: make(map[string]*parse.Tree)}
+	if _, err := parse.New(name).Parse(src, "", "", s.trees, a.funcs); err != nil {
+		return nil, err
+	}
+	if a.marked {
+		for _, tree := range s.trees {
+			walk(tree.Root, func(n parse.Node) {
+				if t, ok := n.(*parse.TextNode); ok {
+					markText(t, name, src)
+				}
+			})
+		}
+	}
+
+	a.including = append(a.including, name)
+	defer func() { a.including = a.including[:len(a.including)-1] }()
+	for _, tname := range sortedTrees(s.trees) {
+		tree := s.trees[tname]
+		if err := a.expand(s, tree, tree.Root, tname == name); err != nil {
+			return nil, err
+		}
+	}
+	a.m.PrintIf("added node")
+	return s, nil
+}
+
+// expand removes extends directives from a list, recording the template
+// extended, and replaces include directives with the included template.
+func (a *assembly) expand(s *source, tree *parse.Tree, list *parse.ListNode, top bool) error {
+	var nodes []parse.Node
+	for _, n := range list.Nodes {
+		var err error
+		switch n := n.(type) {
+		case *parse.ActionNode:
+			kind, name, dErr := directive(tree, n)
+			if dErr != nil {
+				return dErr
+			}
+			loc, _ := tree.ErrorContext(n)
+			switch kind {
+			case "extends":
+				switch {
+				case !top:
+					return DirectiveError(loc, "extends must be at the top level of a template")
+				case s.extends != "":
+					return DirectiveError(loc, "a template may only extend one other")
+				}
+				s.extends, s.extendsAt = name, loc
+				continue
+			case "include":
+				inc, iErr := a.load(name)
+				if iErr != nil {
+					return DirectiveError(loc, iErr.Error())
+				}
+				if inc.extends != "" {
+					return DirectiveError(loc, "included template "+name+" extends "+inc.extends)
+				}
+				for _, iname := range sortedTrees(inc.trees) {
+					if iname == name {
+						nodes = append(nodes, inc.trees[iname].Root.Nodes...)
+					} else {
+						s.trees[iname] = inc.trees[iname]
+					}
+				}
+				continue
+			}
+		case *parse.IfNode:
+			err = a.expandBranch(s, tree, &n.BranchNode)
+		case *parse.RangeNode:
+			err = a.expandBranch(s, tree, &n.BranchNode)
+		case *parse.WithNode:
+			err = a.expandBranch(s, tree, &n.BranchNode)
+		}
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, n)
+	}
+	list.Nodes = nodes
+	return nil
+}
+
+func (a *assembly) expandBranch(s *source, tree *parse.Tree, b *parse.BranchNode) error {
+	if err := a.expand(s, tree, b.List, false); err != nil {
+		return err
+	}
+	if b.ElseList != nil {
+		return a.expand(s, tree, b.ElseList, false)
+	}
+	return nil
+}
+
+// chain loads t and the templates it extends, most basic first.
+func (a *assembly) chain(t string) ([]*source, error) {
+	var chain []*source
+	seen := make(map[string]bool)
+	for name, at := t, ""; name != ""; {
+		if seen[name] {
+			return nil, DirectiveError(at, "extends cycle at "+name)
+		}
+		seen[name] = true
+		s, err := a.load(name)
+		if err != nil {
+			if at != "" {
+				err = DirectiveError(at, err.Error())
+			}
+			return nil, err
+		}
+		chain = append([]*source{s}, chain...)
+		name, at = s.extends, s.extendsAt
+	}
+	return chain, nil
+}
+
+func (m *manager) nodes(t string) ([]*Node, error) {
+	a := m.newAssembly(false)
+	if _, err := a.chain(t); err != nil {
+		return nil, err
+	}
+	return a.nodes, nil
+}
+
+func (m *manager) assemble(t string, marked bool) (*template.Template, error) {
+	m.PrintIf("assembling...%s", t)
+	chain, err := m.newAssembly(marked).chain(t)
+	if err != nil {
+		return nil, err
+	}
+
+	root := template.New(chain[0].name).Funcs(m.GetFuncs())
+	for _, s := range chain {
+		for _, name := range sortedTrees(s.trees) {
+			if _, err := root.AddParseTree(name, s.trees[name]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := references(root); err != nil {
+		return nil, err
+	}
+
+	m.PrintIf("assembled")
+	return root, nil
+}
+
+// references returns an error locating the first template call to a name
+// no template in the set defines.
+func references(root *template.Template) error {
+	tmpls := root.Templates()
+	sort.Slice(tmpls, func(i, j int) bool { return tmpls[i].Name() < tmpls[j].Name() })
+	for _, tmpl := range tmpls {
+		if tmpl.Tree == nil {
+			continue
+		}
+		var err error
+		walk(tmpl.Tree.Root, func(n parse.Node) {
+			if tn, ok := n.(*parse.TemplateNode); ok && err == nil && root.Lookup(tn.Name) == nil {
+				loc, _ := tmpl.Tree.ErrorContext(tn)
+				err = ReferenceError(loc, tn.Name)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package marid
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	cases := []struct {
+		name      string
+		templates map[string]string
+		expect    string
+		err       string
+	}{
+		{
+			"whitespace variants",
+			map[string]string{
+				"t":    "{{- extends `base` -}}\n{{- define \"root\" -}}\n[{{ include \"inc\" }}]\n{{- end }}",
+				"base": "{{ template \"header\" . }}{{ template \"root\" . }}{{ define \"header\" }}{{ end }}",
+				"inc":  `{{if true}}"quoted"{{end}}`,
+			},
+			`["quoted"]`,
+			"",
+		},
+		{
+			"override",
+			map[string]string{
+				"t":    `{{extends "base"}}{{define "header"}}H:{{end}}{{define "root"}}R{{end}}`,
+				"base": `{{ template "header" . }}{{ template "root" . }}{{ define "header" }}{{ end }}`,
+			},
+			"H:R",
+			"",
+		},
+		{"undefined", map[string]string{"t": "\n  {{ template \"nope\" . }}"}, "", `t:2:14: template "nope" is not defined`},
+		{"missing include", map[string]string{"t": `{{ include "nope" }}`}, "", "t:1:3: no template named nope"},
+		{"argument", map[string]string{"t": `{{ extends .Base }}`}, "", "t:1:3: extends takes a single quoted template name"},
+		{"nested extends", map[string]string{"t": `{{ if true }}{{ extends "x" }}{{ end }}`}, "", "t:1:16: extends must be at the top level of a template"},
+		{"include cycle", map[string]string{"t": `{{ include "a" }}`, "a": `{{ include "t" }}`}, "", "t:1:3: a:1:3: t: include cycle t -> a -> t"},
+	}
+	for _, c := range cases {
+		m := New(Loaders(MapLoader(c.templates)), LockFile("")).(*manager)
+		m.Configure()
+		tmpl, err := m.Fetch("t")
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%s: error %v, expected %q", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, nil); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		} else if b.String() != c.expect {
+			t.Errorf("%s: rendered %q, expected %q", c.name, b.String(), c.expect)
+		}
+	}
+}
+
+func TestRenderReturnsAssemblyErrors(t *testing.T) {
+	m := New(Loaders(MapLoader(map[string]string{"t": "\n  {{ template \"nope\" . }}"})), Sink(NewMemorySink()), LockFile("")).(*manager)
+	m.Configure()
+	err := m.Render("t", ".", nil)
+	if expect := `t:2:14: template "nope" is not defined`; err == nil || err.Error() != expect {
+		t.Errorf("error %v, expected %q", err, expect)
+	}
+}
@@ -0,0 +1,107 @@
+package marid
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type Pruner interface {
+	Orphans(string, []string) ([]string, error)
+	Prune(string, []string) ([]string, error)
+}
+
+// orphans returns the files recorded in the lock for the same variant of a
+// block that it no longer produces. Files elsewhere in the directory marked
+// as generated by the block are only reported, as they may belong to another
+// variant generated without a lock. A recorded file that has since been
+// replaced, losing both its marker and its recorded content, is kept.
+func (m *manager) orphans(e *LockEntry) ([]string, error) {
+	current := make(map[string]bool)
+	for _, o := range e.Outputs {
+		current[filepath.Clean(o.Path)] = true
+	}
+
+	found := make(map[string]string)
+	recorded := make(map[string]bool)
+	if m.lockFile != "" {
+		l, err := m.readLock()
+		if err != nil {
+			return nil, err
+		}
+		for _, prev := range l.Entries {
+			same := m.sameVariant(prev, e)
+			for _, o := range prev.Outputs {
+				path := filepath.Clean(o.Path)
+				if same && !current[path] {
+					found[path] = o.Hash
+				} else {
+					recorded[path] = true
+				}
+			}
+		}
+	}
+
+	var ret []string
+	for path, hash := range found {
+		src, err := m.existing(path)
+		switch {
+		case err != nil, recorded[path]:
+		case generatedBy(src, e.Block), hashBytes(src) == hash:
+			ret = append(ret, path)
+		default:
+			m.Printf("warning: %s is no longer produced by block %s but was edited by hand, leaving it", path, e.Block)
+		}
+	}
+	sort.Strings(ret)
+
+	infos, err := ioutil.ReadDir(e.Directory)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, RenderError(err)
+	}
+	for _, fi := range infos {
+		path := filepath.Join(e.Directory, fi.Name())
+		if _, ok := found[path]; ok || !fi.Mode().IsRegular() || current[path] || recorded[path] {
+			continue
+		}
+		if src, rErr := m.existing(path); rErr == nil && generatedBy(src, e.Block) {
+			m.PrintIf("%s was generated by block %s but is not recorded for this variant, leaving it", path, e.Block)
+		}
+	}
+	return ret, nil
+}
+
+func (m *manager) remove(paths ...string) error {
+	rs, ok := m.sink.(RemovableSink)
+	if !ok {
+		return PruneError("output sink does not support removing files")
+	}
+	for _, path := range paths {
+		if err := rs.Remove(path); err != nil {
+			return PruneError(err)
+		}
+		if err := rs.Remove(baselinePath(path)); err != nil && !os.IsNotExist(err) {
+			return PruneError(err)
+		}
+		m.PrintIf("pruned %s", path)
+	}
+	return nil
+}
+
+func (m *manager) Orphans(bl string, fl []string) ([]string, error) {
+	_, entry, err := m.build(newRequest(nil, bl, fl, nil))
+	if err != nil {
+		return nil, err
+	}
+	return m.orphans(entry)
+}
+
+func (m *manager) Prune(bl string, fl []string) ([]string, error) {
+	m.PrintIf("Pruning block %s with args %s", bl, fl)
+	orphaned, err := m.Orphans(bl, fl)
+	if err != nil {
+		return nil, err
+	}
+	return orphaned, m.remove(orphaned...)
+}
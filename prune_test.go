@@ -0,0 +1,113 @@
+package marid
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "marid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func variantManager(dir string, templates ...string) *manager {
+	l := MapLoader(map[string]string{
+		"t": `{{ extends "block_base" }}{{ define "block_root" }}package p
+
+type {{ .Name }} struct{}
+{{ end }}`,
+		"u": `{{ extends "block_base" }}{{ define "block_root" }}package p
+{{ end }}`,
+	})
+	ps := ParamSet{StringParam("Name", "", "").Require()}
+	blk := BasicBlock("variant", ps, l, templates, OutputNames(map[string]string{
+		"t": "{{ snake .Name }}.go",
+		"u": "{{ snake .Name }}_u.go",
+	}))
+	m := New(Blocks(blk), Prune(true), LockFile(filepath.Join(dir, "marid.lock"))).(*manager)
+	m.Configure()
+	return m
+}
+
+func TestGeneratedBy(t *testing.T) {
+	cases := []struct {
+		header string
+		tag    string
+		expect bool
+	}{
+		{"// Code generated by marid devel from block xrror. DO NOT EDIT.", "xrror", true},
+		{"// Code generated by marid devel from block xrror with flags -ErrorName=E. DO NOT EDIT.", "xrror", true},
+		{"# Code generated by marid devel from block xrror. DO NOT EDIT.", "xrror", true},
+		{"// Code generated by marid devel from block xrror.v2. DO NOT EDIT.", "xrror", false},
+		{"// Code generated by marid devel from block xrror.v2 with flags -ErrorName=E. DO NOT EDIT.", "xrror", false},
+		{"// Code generated by marid devel from block xrror2. DO NOT EDIT.", "xrror", false},
+		{"// Code generated by marid devel from block xrror.v2. DO NOT EDIT.", "xrror.v2", true},
+	}
+	for _, c := range cases {
+		if got := generatedBy([]byte(c.header+"\n\npackage p\n"), c.tag); got != c.expect {
+			t.Errorf("generatedBy(%q, %q) = %t, expected %t", c.header, c.tag, got, c.expect)
+		}
+	}
+}
+
+func TestPruneKeepsOtherVariants(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	m := variantManager(dir, "t", "u")
+	for _, name := range []string{"Alpha", "Beta"} {
+		r, err := m.DoWith(context.Background(), "variant", Params{"Name": name}, InDirectory(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.Pruned) != 0 {
+			t.Errorf("%s pruned %v", name, r.Pruned)
+		}
+	}
+
+	// dropping a template prunes only the variant regenerated
+	m = variantManager(dir, "t")
+	r, err := m.DoWith(context.Background(), "variant", Params{"Name": "Alpha"}, InDirectory(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{filepath.Join(dir, "alpha_u.go")}; !reflect.DeepEqual(r.Pruned, expect) {
+		t.Errorf("pruned %v, expected %v", r.Pruned, expect)
+	}
+	for _, name := range []string{"alpha.go", "beta.go", "beta_u.go"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestPruneKeepsEditedFiles(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	m := variantManager(dir, "t", "u")
+	if _, err := m.DoWith(context.Background(), "variant", Params{"Name": "Alpha"}, InDirectory(dir)); err != nil {
+		t.Fatal(err)
+	}
+	edited := filepath.Join(dir, "alpha_u.go")
+	if err := ioutil.WriteFile(edited, []byte("package p\n\nfunc Mine() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m = variantManager(dir, "t")
+	r, err := m.DoWith(context.Background(), "variant", Params{"Name": "Alpha"}, InDirectory(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Pruned) != 0 {
+		t.Errorf("pruned %v", r.Pruned)
+	}
+	if _, err := os.Stat(edited); err != nil {
+		t.Error(err)
+	}
+}
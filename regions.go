@@ -0,0 +1,100 @@
+package marid
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	reRegionBegin *regexp.Regexp = regexp.MustCompile(`^\s*// marid:begin (\S+)\s*$`)
+	reRegionEnd   *regexp.Regexp = regexp.MustCompile(`^\s*// marid:end\s*$`)
+)
+
+type region struct {
+	name string
+	body string
+}
+
+func parseRegions(src []byte) ([]*region, error) {
+	var ret []*region
+	var current *region
+	seen := make(map[string]bool)
+	for i, line := range strings.SplitAfter(string(src), "\n") {
+		trimmed := strings.TrimRight(line, "\n")
+		if m := reRegionBegin.FindStringSubmatch(trimmed); m != nil {
+			if current != nil {
+				return nil, fmt.Errorf("line %d: region %s begins inside region %s", i+1, m[1], current.name)
+			}
+			if seen[m[1]] {
+				return nil, fmt.Errorf("line %d: duplicate region %s", i+1, m[1])
+			}
+			seen[m[1]] = true
+			current = &region{name: m[1]}
+			continue
+		}
+		if reRegionEnd.MatchString(trimmed) {
+			if current == nil {
+				return nil, fmt.Errorf("line %d: marid:end without marid:begin", i+1)
+			}
+			ret = append(ret, current)
+			current = nil
+			continue
+		}
+		if current != nil {
+			current.body = current.body + line
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("region %s is never closed", current.name)
+	}
+	return ret, nil
+}
+
+func (m *manager) preserve(path string, src, existing []byte) ([]byte, error) {
+	if _, err := parseRegions(src); err != nil {
+		return nil, RegionError(path, err)
+	}
+	previous, err := parseRegions(existing)
+	if err != nil {
+		return nil, RegionError(path, err)
+	}
+	if len(previous) == 0 {
+		return src, nil
+	}
+
+	kept := make(map[string]*region)
+	for _, r := range previous {
+		kept[r.name] = r
+	}
+
+	var b bytes.Buffer
+	var current *region
+	for _, line := range strings.SplitAfter(string(src), "\n") {
+		trimmed := strings.TrimRight(line, "\n")
+		if mt := reRegionBegin.FindStringSubmatch(trimmed); mt != nil {
+			b.WriteString(line)
+			if r, ok := kept[mt[1]]; ok {
+				b.WriteString(r.body)
+				delete(kept, mt[1])
+				current = r
+			}
+			continue
+		}
+		if reRegionEnd.MatchString(trimmed) {
+			current = nil
+		}
+		if current == nil {
+			b.WriteString(line)
+		}
+	}
+
+	for _, r := range previous {
+		if _, orphaned := kept[r.name]; orphaned {
+			m.Printf("warning: %s: protected region %s no longer exists in the template, its content was not carried over:\n%s", path, r.name, r.body)
+		}
+	}
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,69 @@
+package marid
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRegions(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []*region
+		err    string
+	}{
+		{"none", "package p\n", nil, ""},
+		{
+			"regions",
+			"a\n// marid:begin one\nbody\n  more\n// marid:end\nb\n\t// marid:begin two\n\t// marid:end\n",
+			[]*region{{"one", "body\n  more\n"}, {"two", ""}},
+			"",
+		},
+		{"nested", "// marid:begin one\n// marid:begin two\n", nil, "line 2: region two begins inside region one"},
+		{"duplicate", "// marid:begin one\n// marid:end\n// marid:begin one\n", nil, "line 3: duplicate region one"},
+		{"stray end", "a\n// marid:end\n", nil, "line 2: marid:end without marid:begin"},
+		{"unclosed", "// marid:begin one\nbody\n", nil, "region one is never closed"},
+	}
+	for _, c := range cases {
+		regions, err := parseRegions([]byte(c.src))
+		switch {
+		case c.err != "":
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%s: error %v, expected %q", c.name, err, c.err)
+			}
+		case err != nil:
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		case !reflect.DeepEqual(regions, c.expect):
+			t.Errorf("%s: regions %v, expected %v", c.name, regions, c.expect)
+		}
+	}
+}
+
+func TestPreserve(t *testing.T) {
+	var out bytes.Buffer
+	m := New(LockFile("")).(*manager)
+	m.Logr = &logr{Logger: log.New(&out, "", 0)}
+	m.Configure()
+
+	src := "package p\n\n// marid:begin kept\n// marid:end\n\n// marid:begin added\ndefault\n// marid:end\n"
+	existing := "package q\n\n// marid:begin kept\nfunc Mine() {}\n// marid:end\n\n// marid:begin removed\nfunc Lost() {}\n// marid:end\n"
+	expect := "package p\n\n// marid:begin kept\nfunc Mine() {}\n// marid:end\n\n// marid:begin added\ndefault\n// marid:end\n"
+
+	preserved, err := m.preserve("p.go", []byte(src), []byte(existing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(preserved) != expect {
+		t.Errorf("preserved\n%s\nexpected\n%s", preserved, expect)
+	}
+	if !strings.Contains(out.String(), "protected region removed no longer exists") {
+		t.Errorf("expected a warning for the removed region, logged %q", out.String())
+	}
+
+	if _, err := m.preserve("p.go", []byte(src), []byte("// marid:begin open\n")); err == nil {
+		t.Error("expected an error for an unclosed region in the existing file")
+	}
+}
@@ -1,13 +1,39 @@
 package marid
 
+import (
+	"io"
+	"os"
+)
+
 type settings struct {
+	version        string
 	verbose        bool
+	dryRun         bool
+	diff           bool
+	force          bool
+	merge          bool
+	prune          bool
+	typeCheck      bool
+	output         io.Writer
+	sink           OutputSink
+	fileMode       os.FileMode
+	lockFile       string
 	bufferPoolSize int
 }
 
 func defaultSettings() *settings {
 	return &settings{
+		version:        "devel",
 		verbose:        false,
+		dryRun:         false,
+		diff:           false,
+		force:          false,
+		merge:          false,
+		prune:          false,
+		typeCheck:      false,
+		output:         os.Stdout,
+		fileMode:       0644,
+		lockFile:       "marid.lock",
 		bufferPoolSize: 10,
 	}
 }
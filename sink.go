@@ -0,0 +1,276 @@
+package marid
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type OutputSink interface {
+	Open(string, os.FileMode) (OutputFile, error)
+}
+
+type ReadableSink interface {
+	OutputSink
+	Existing(string) ([]byte, error)
+}
+
+type RemovableSink interface {
+	OutputSink
+	Remove(string) error
+}
+
+type OutputFile interface {
+	io.Writer
+	Commit() error
+	Discard() error
+}
+
+type fileSink struct{}
+
+func FileSink() OutputSink {
+	return &fileSink{}
+}
+
+func (s *fileSink) Open(path string, mode os.FileMode) (OutputFile, error) {
+	created := missingDirs(filepath.Dir(path))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), fmt.Sprintf(".%s.", filepath.Base(path)))
+	if err != nil {
+		removeDirs(created)
+		return nil, err
+	}
+	return &fileOutput{File: tmp, path: path, mode: mode, created: created}, nil
+}
+
+// missingDirs returns the directories leading to dir that do not exist yet,
+// deepest first.
+func missingDirs(dir string) []string {
+	var dirs []string
+	for {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			return dirs
+		}
+		dirs = append(dirs, dir)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dirs
+		}
+		dir = parent
+	}
+}
+
+// removeDirs removes the directories given, deepest first, stopping at the
+// first that is not empty.
+func removeDirs(dirs []string) {
+	for _, dir := range dirs {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fileSink) Existing(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+func (s *fileSink) Remove(path string) error {
+	return os.Remove(path)
+}
+
+type fileOutput struct {
+	*os.File
+	path      string
+	mode      os.FileMode
+	committed bool
+	existed   bool
+	previous  []byte
+	prevMode  os.FileMode
+	created   []string
+}
+
+func (f *fileOutput) Commit() error {
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), f.mode); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(f.path); err == nil {
+		prev, rErr := ioutil.ReadFile(f.path)
+		if rErr != nil {
+			return rErr
+		}
+		f.existed, f.previous, f.prevMode = true, prev, fi.Mode()
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		return err
+	}
+	f.committed = true
+	return nil
+}
+
+// Discard undoes the output, removing any directories Open created for it
+// that are left empty.
+func (f *fileOutput) Discard() error {
+	if !f.committed {
+		f.Close()
+		err := os.Remove(f.Name())
+		removeDirs(f.created)
+		return err
+	}
+	f.committed = false
+	if !f.existed {
+		err := os.Remove(f.path)
+		removeDirs(f.created)
+		return err
+	}
+	if err := ioutil.WriteFile(f.path, f.previous, f.prevMode); err != nil {
+		return err
+	}
+	return os.Chmod(f.path, f.prevMode)
+}
+
+type bufferedOutput struct {
+	bytes.Buffer
+	path   string
+	mode   os.FileMode
+	commit func(*bufferedOutput) (func(), error)
+	undo   func()
+}
+
+func (b *bufferedOutput) Commit() error {
+	undo, err := b.commit(b)
+	b.undo = undo
+	return err
+}
+
+func (b *bufferedOutput) Discard() error {
+	if b.undo != nil {
+		b.undo()
+		b.undo = nil
+	}
+	b.Reset()
+	return nil
+}
+
+func archivePath(path string) string {
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "/")
+}
+
+type MemorySink struct {
+	sync.Mutex
+	Files map[string][]byte
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{Files: make(map[string][]byte)}
+}
+
+func (s *MemorySink) Open(path string, mode os.FileMode) (OutputFile, error) {
+	return &bufferedOutput{path: path, mode: mode, commit: s.commit}, nil
+}
+
+func (s *MemorySink) Existing(path string) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+	if src, ok := s.Files[path]; ok {
+		return src, nil
+	}
+	return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+}
+
+func (s *MemorySink) Remove(path string) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.Files[path]; !ok {
+		return &os.PathError{Op: "remove", Path: path, Err: os.ErrNotExist}
+	}
+	delete(s.Files, path)
+	return nil
+}
+
+func (s *MemorySink) commit(b *bufferedOutput) (func(), error) {
+	s.Lock()
+	defer s.Unlock()
+	prev, existed := s.Files[b.path]
+	s.Files[b.path] = append([]byte(nil), b.Bytes()...)
+	return func() {
+		s.Lock()
+		defer s.Unlock()
+		if existed {
+			s.Files[b.path] = prev
+		} else {
+			delete(s.Files, b.path)
+		}
+	}, nil
+}
+
+type ZipSink struct {
+	sync.Mutex
+	*zip.Writer
+}
+
+func NewZipSink(w io.Writer) *ZipSink {
+	return &ZipSink{Writer: zip.NewWriter(w)}
+}
+
+func (s *ZipSink) Open(path string, mode os.FileMode) (OutputFile, error) {
+	return &bufferedOutput{path: path, mode: mode, commit: s.commit}, nil
+}
+
+func (s *ZipSink) commit(b *bufferedOutput) (func(), error) {
+	s.Lock()
+	defer s.Unlock()
+	h := &zip.FileHeader{
+		Name:   archivePath(b.path),
+		Method: zip.Deflate,
+	}
+	h.SetMode(b.mode)
+	h.SetModTime(time.Now())
+	w, err := s.CreateHeader(h)
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(b.Bytes())
+	return nil, err
+}
+
+type TarSink struct {
+	sync.Mutex
+	*tar.Writer
+}
+
+func NewTarSink(w io.Writer) *TarSink {
+	return &TarSink{Writer: tar.NewWriter(w)}
+}
+
+func (s *TarSink) Open(path string, mode os.FileMode) (OutputFile, error) {
+	return &bufferedOutput{path: path, mode: mode, commit: s.commit}, nil
+}
+
+func (s *TarSink) commit(b *bufferedOutput) (func(), error) {
+	s.Lock()
+	defer s.Unlock()
+	h := &tar.Header{
+		Name:    archivePath(b.path),
+		Mode:    int64(b.mode.Perm()),
+		Size:    int64(b.Len()),
+		ModTime: time.Now(),
+	}
+	if err := s.WriteHeader(h); err != nil {
+		return nil, err
+	}
+	_, err := s.Write(b.Bytes())
+	return nil, err
+}
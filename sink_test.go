@@ -0,0 +1,52 @@
+package marid
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSinkDiscardRemovesCreatedDirs(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "kept"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "kept", "a.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := FileSink()
+	var files []OutputFile
+	for _, p := range []string{"sub/deep/x.go", "sub/y.go", "kept/b.go", "kept/new/c.go"} {
+		f, err := s.Open(filepath.Join(dir, p), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte("package p\n")); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	// commit all but the last, as a failed write leaves them
+	for _, f := range files[:len(files)-1] {
+		if err := f.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		if err := files[i].Discard(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, p := range []string{"sub", "kept/new", "kept/b.go"} {
+		if _, err := os.Stat(filepath.Join(dir, p)); !os.IsNotExist(err) {
+			t.Errorf("%s was left behind: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "kept", "a.go")); err != nil {
+		t.Errorf("existing file was removed: %v", err)
+	}
+}
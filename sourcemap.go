@@ -0,0 +1,184 @@
+package marid
+
+import (
+	"bytes"
+	"fmt"
+	"go/scanner"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// Parsed template text is marked at its start and at the start of each of
+// its lines with the template name and source line, so that rendered output
+// can be traced back to the template that produced it.
+const (
+	markStart = "\x1e"
+	markSep   = "\x1d"
+	markEnd   = "\x1f"
+)
+
+func markText(t *parse.TextNode, name, src string) {
+	line := 1 + strings.Count(src[:t.Pos], "\n")
+	var b bytes.Buffer
+	for i, piece := range strings.SplitAfter(string(t.Text), "\n") {
+		if i == 0 || piece != "" {
+			fmt.Fprintf(&b, "%s%s%s%d%s", markStart, name, markSep, line+i, markEnd)
+		}
+		b.WriteString(piece)
+	}
+	t.Text = b.Bytes()
+}
+
+type origin struct {
+	template string
+	line     int
+}
+
+// unmark strips line marks from rendered output, returning the clean output
+// and the template origin of each of its lines.
+func unmark(src []byte) ([]byte, []origin) {
+	var b bytes.Buffer
+	var origins []origin
+	var current origin
+	lineStart := true
+	for len(src) > 0 {
+		if bytes.HasPrefix(src, []byte(markStart)) {
+			end := bytes.Index(src, []byte(markEnd))
+			if end < 0 {
+				break
+			}
+			mark := string(src[len(markStart):end])
+			if sep := strings.LastIndex(mark, markSep); sep >= 0 {
+				line, _ := strconv.Atoi(mark[sep+len(markSep):])
+				current = origin{mark[:sep], line}
+			}
+			src = src[end+len(markEnd):]
+			continue
+		}
+		c := src[0]
+		if lineStart && c != ' ' && c != '\t' {
+			origins = append(origins, current)
+			lineStart = false
+		}
+		if c == '\n' {
+			if lineStart {
+				origins = append(origins, current)
+			}
+			lineStart = true
+		}
+		b.WriteByte(c)
+		src = src[1:]
+	}
+	if lineStart {
+		origins = append(origins, current)
+	}
+	return b.Bytes(), origins
+}
+
+type GoSourceError struct {
+	File         string
+	Line         int
+	Column       int
+	Msg          string
+	Snippet      string
+	Template     string
+	TemplateLine int
+}
+
+func (g *GoSourceError) Error() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "invalid Go generated at %s:%d:%d: %s", g.File, g.Line, g.Column, g.Msg)
+	if g.Template != "" {
+		fmt.Fprintf(&b, "\nemitted by template %s line %d", g.Template, g.TemplateLine)
+	}
+	if g.Snippet != "" {
+		fmt.Fprintf(&b, "\n%s", g.Snippet)
+	}
+	return b.String()
+}
+
+func (g *GoSourceError) locate(origins []origin) {
+	if g.Line > 0 && g.Line <= len(origins) {
+		if o := origins[g.Line-1]; o.template != "" {
+			g.Template, g.TemplateLine = o.template, o.line
+		}
+	}
+}
+
+const snippetContext = 3
+
+func snippet(src []byte, line, column int) string {
+	lines := splitLines(src)
+	var b bytes.Buffer
+	for i := line - snippetContext; i <= line+snippetContext; i++ {
+		if i < 1 || i > len(lines) {
+			continue
+		}
+		mark := " "
+		if i == line {
+			mark = ">"
+		}
+		fmt.Fprintf(&b, "%s %4d | %s\n", mark, i, lines[i-1])
+		if i == line && column > 0 {
+			fmt.Fprintf(&b, "       | %s^\n", indent(lines[i-1], column-1))
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// indent returns whitespace spanning the first n bytes of line, keeping tabs
+// so that a caret lines up beneath the column it points at.
+func indent(line string, n int) string {
+	if n > len(line) {
+		n = len(line)
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, line[:n])
+}
+
+// goSourceError locates the first error reported by the go parser or
+// formatter in src.
+func goSourceError(name string, src []byte, err error) error {
+	list, ok := err.(scanner.ErrorList)
+	if !ok || len(list) == 0 {
+		return InvalidGoCodeError(err)
+	}
+	first := list[0]
+	return &GoSourceError{
+		File:    name,
+		Line:    first.Pos.Line,
+		Column:  first.Pos.Column,
+		Msg:     first.Msg,
+		Snippet: snippet(src, first.Pos.Line, first.Pos.Column),
+	}
+}
+
+// retrace maps the lines of src, a post processed form of rendered, back to
+// template origins, matching lines regardless of the whitespace formatting
+// has changed.
+func retrace(rendered, src []byte, origins []origin) []origin {
+	compact := func(lines []string) []string {
+		for i, l := range lines {
+			lines[i] = strings.Join(strings.Fields(l), "")
+		}
+		return lines
+	}
+	at := func(i int) origin {
+		if i < len(origins) {
+			return origins[i]
+		}
+		return origin{}
+	}
+	var traced []origin
+	for _, d := range diffLines(compact(splitLines(rendered)), compact(splitLines(src))) {
+		if d.kind != '-' {
+			traced = append(traced, at(d.a))
+		}
+	}
+	return traced
+}
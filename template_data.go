@@ -2,6 +2,8 @@ package marid
 
 import (
 	"flag"
+	"fmt"
+	"strings"
 )
 
 type TemplateData struct {
@@ -13,13 +15,34 @@ func NewTemplateData(b Block, fs *flag.FlagSet) *TemplateData {
 		Data: make(map[string]interface{}),
 	}
 
+	var flags []string
 	fn := func(fl *flag.Flag) {
-		ret.Data[fl.Name] = fl.Value
+		if reserved(fl.Name) {
+			return
+		}
+		ret.Data[fl.Name] = flagValue(fl)
+		flags = append(flags, fmtFlag(fl))
 	}
 	fs.VisitAll(fn)
 
 	ret.Data["PackageName"] = b.Package()
 	ret.Data["Block"] = b.Tag()
+	ret.Data["MaridFlags"] = strings.Join(flags, " ")
 
 	return ret
 }
+
+func flagValue(fl *flag.Flag) interface{} {
+	if g, ok := fl.Value.(flag.Getter); ok {
+		return g.Get()
+	}
+	return fl.Value.String()
+}
+
+func fmtFlag(fl *flag.Flag) string {
+	v := fl.Value.String()
+	if v == "" || strings.ContainsAny(v, " \t\n\"") {
+		v = fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprintf("-%s=%s", fl.Name, v)
+}
@@ -1,5 +1,12 @@
 package marid
 
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
 type FuncSet struct {
 	f map[string]interface{}
 }
@@ -17,3 +24,38 @@ func (f *FuncSet) AddFuncs(fns map[string]interface{}) {
 func (f *FuncSet) GetFuncs() map[string]interface{} {
 	return f.f
 }
+
+var baseFuncs map[string]interface{} = map[string]interface{}{
+	"lower":  strings.ToLower,
+	"upper":  strings.ToUpper,
+	"first":  first,
+	"snake":  snake,
+	"import": importRequest,
+}
+
+func first(s string) string {
+	if s == "" {
+		return ""
+	}
+	_, size := utf8.DecodeRuneInString(s)
+	return s[:size]
+}
+
+func snake(s string) string {
+	var b bytes.Buffer
+	rs := []rune(s)
+	for i, r := range rs {
+		switch {
+		case r == '-' || r == ' ':
+			b.WriteRune('_')
+		case unicode.IsUpper(r):
+			if i > 0 && rs[i-1] != '_' && (unicode.IsLower(rs[i-1]) || unicode.IsDigit(rs[i-1]) || (i+1 < len(rs) && unicode.IsLower(rs[i+1]))) {
+				b.WriteRune('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
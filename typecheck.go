@@ -0,0 +1,119 @@
+package marid
+
+import (
+	"bytes"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func checkable(o *output) bool {
+	return filepath.Ext(o.path) == ".go" && !strings.HasSuffix(o.path, "_test.go") && !o.conflict && matches(o)
+}
+
+// matches reports whether the build context would include a rendered file,
+// reading its build constraints from the rendered source.
+func matches(o *output) bool {
+	ctxt := build.Default
+	ctxt.OpenFile = func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(o.src)), nil
+	}
+	match, err := ctxt.MatchFile(filepath.Dir(o.path), filepath.Base(o.path))
+	return err == nil && match
+}
+
+// verify type checks rendered Go outputs together with the rest of the
+// package in each directory they are written to, returning the first type
+// error found in a rendered file.
+func (m *manager) verify(outs []*output) error {
+	byDir := make(map[string][]*output)
+	for _, o := range outs {
+		if checkable(o) {
+			dir := filepath.Dir(o.path)
+			byDir[dir] = append(byDir[dir], o)
+		}
+	}
+	var dirs []string
+	for dir := range byDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if err := m.verifyPackage(dir, byDir[dir]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *manager) verifyPackage(dir string, outs []*output) error {
+	m.PrintIf("type checking package in %s...", dir)
+	fset := token.NewFileSet()
+	rendered := make(map[string]*output)
+	var files []*ast.File
+	var pkg string
+	for _, o := range outs {
+		f, err := parser.ParseFile(fset, o.path, o.src, 0)
+		if err != nil {
+			return goSourceError(o.path, o.src, err)
+		}
+		rendered[o.path] = o
+		files = append(files, f)
+		pkg = f.Name.Name
+	}
+
+	siblings, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, path := range siblings {
+		if _, ok := rendered[path]; ok || strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		if match, err := build.Default.MatchFile(dir, filepath.Base(path)); err != nil || !match {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil || f.Name.Name != pkg {
+			continue
+		}
+		files = append(files, f)
+	}
+
+	var first *GoSourceError
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error: func(err error) {
+			tErr, ok := err.(types.Error)
+			if !ok {
+				return
+			}
+			pos := fset.Position(tErr.Pos)
+			o, ok := rendered[pos.Filename]
+			if !ok {
+				m.Printf("warning: %s: %s", pos, tErr.Msg)
+				return
+			}
+			if first == nil {
+				first = &GoSourceError{
+					File:    o.path,
+					Line:    pos.Line,
+					Column:  pos.Column,
+					Msg:     tErr.Msg,
+					Snippet: snippet(o.src, pos.Line, pos.Column),
+				}
+				first.locate(o.origins)
+			}
+		},
+	}
+	conf.Check(pkg, fset, files, nil)
+	if first != nil {
+		return first
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package marid
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/token"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Rule func(interface{}) error
+
+func eachString(v interface{}, fn func(string) error) error {
+	switch val := v.(type) {
+	case string:
+		return fn(val)
+	case []string:
+		for _, s := range val {
+			if err := fn(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]string:
+		for k := range val {
+			if err := fn(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%v is not a string value", v)
+}
+
+func isIdentifier(s string) bool {
+	if s == "" || token.Lookup(s).IsKeyword() {
+		return false
+	}
+	for i, r := range s {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+var Identifier Rule = func(v interface{}) error {
+	return eachString(v, func(s string) error {
+		if !isIdentifier(s) {
+			return fmt.Errorf("%q is not a valid Go identifier", s)
+		}
+		return nil
+	})
+}
+
+var ExportedIdentifier Rule = func(v interface{}) error {
+	return eachString(v, func(s string) error {
+		if !isIdentifier(s) {
+			return fmt.Errorf("%q is not a valid Go identifier", s)
+		}
+		if r, _ := utf8.DecodeRuneInString(s); !unicode.IsUpper(r) {
+			return fmt.Errorf("%q is not an exported Go identifier", s)
+		}
+		return nil
+	})
+}
+
+func Matches(expr string) Rule {
+	re := regexp.MustCompile(expr)
+	return func(v interface{}) error {
+		return eachString(v, func(s string) error {
+			if !re.MatchString(s) {
+				return fmt.Errorf("%q does not match %s", s, expr)
+			}
+			return nil
+		})
+	}
+}
+
+func OneOf(choices ...string) Rule {
+	return func(v interface{}) error {
+		return eachString(v, func(s string) error {
+			if !contains(choices, s) {
+				return fmt.Errorf("%q is not one of %s", s, strings.Join(choices, ", "))
+			}
+			return nil
+		})
+	}
+}
+
+func NoneOf(names ...string) Rule {
+	return func(v interface{}) error {
+		return eachString(v, func(s string) error {
+			if contains(names, s) {
+				return fmt.Errorf("%q is reserved, it may not be one of %s", s, strings.Join(names, ", "))
+			}
+			return nil
+		})
+	}
+}
+
+type Violation struct {
+	Param   string
+	Message string
+}
+
+type ValidationError struct {
+	Block      string
+	Violations []*Violation
+}
+
+func (v *ValidationError) Error() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "invalid params for block %s", v.Block)
+	for _, vl := range v.Violations {
+		fmt.Fprintf(&b, "\n\t-%s: %s", vl.Param, vl.Message)
+	}
+	return b.String()
+}
+
+func validate(tag string, fs *flag.FlagSet, set map[string]bool) error {
+	verr := &ValidationError{Block: tag}
+	fs.VisitAll(func(fl *flag.Flag) {
+		pv, ok := fl.Value.(*paramValue)
+		if !ok {
+			return
+		}
+		if pv.param.Required && !set[fl.Name] {
+			verr.Violations = append(verr.Violations, &Violation{fl.Name, "is required"})
+			return
+		}
+		for _, r := range pv.param.Rules {
+			if err := r(pv.Get()); err != nil {
+				verr.Violations = append(verr.Violations, &Violation{fl.Name, err.Error()})
+			}
+		}
+	})
+
+	if len(verr.Violations) > 0 {
+		return verr
+	}
+	return nil
+}